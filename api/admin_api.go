@@ -0,0 +1,25 @@
+package api
+
+import (
+	"github.com/yux77yux/blog-backend/config"
+	"github.com/yux77yux/blog-backend/internal/handlers/admin"
+	"github.com/yux77yux/blog-backend/internal/middleware"
+	"github.com/yux77yux/blog-backend/utils/rbac_utils"
+	"net/http"
+)
+
+func requirePermission(permission string, handler http.HandlerFunc) http.Handler {
+	return config.CorsMiddleware(middleware.Authenticate(middleware.RequirePermission(permission)(handler)))
+}
+
+func AdminHandlers(mux *http.ServeMux) {
+	mux.Handle("/api/admin/unlock-user", requirePermission(rbac_utils.PermUserModerate, admin.UnlockUser))
+	mux.Handle("/api/admin/users/status", requirePermission(rbac_utils.PermUserModerate, admin.AccountStatus))
+	mux.Handle("/api/admin/users/suspend", requirePermission(rbac_utils.PermUserModerate, admin.SuspendUser))
+	mux.Handle("/api/admin/users/ban", requirePermission(rbac_utils.PermUserModerate, admin.BanUser))
+	mux.Handle("/api/admin/users/reinstate", requirePermission(rbac_utils.PermUserModerate, admin.ReinstateUser))
+	mux.Handle("/api/admin/roles", requirePermission(rbac_utils.PermRoleManage, admin.ListRoles))
+	mux.Handle("/api/admin/roles/grant", requirePermission(rbac_utils.PermRoleManage, admin.GrantRole))
+	mux.Handle("/api/admin/roles/revoke", requirePermission(rbac_utils.PermRoleManage, admin.RevokeRole))
+	mux.Handle("/api/admin/audit", requirePermission(rbac_utils.PermAuditRead, admin.ListAuditEvents))
+}
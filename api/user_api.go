@@ -3,16 +3,51 @@ package api
 import (
 	"github.com/yux77yux/blog-backend/config"
 	"github.com/yux77yux/blog-backend/internal/handlers/user"
+	"github.com/yux77yux/blog-backend/internal/middleware"
+	"github.com/yux77yux/blog-backend/utils/rbac_utils"
 	"net/http"
 )
 
+// 密码、邮箱、两步验证、通行密钥、会话、令牌和注销账号只能在登录会话中操作，个人访问令牌不能调用；
+// 其余接口用 requirePermission 按权限放行，令牌需要带有对应的 scope
+func signedIn(handler http.HandlerFunc) http.Handler {
+	return config.CorsMiddleware(middleware.Authenticate(middleware.RequireSession(handler)))
+}
+
 func UserHandlers(mux *http.ServeMux) {
 	mux.Handle("/api/user/sign-in", config.CorsMiddleware(http.HandlerFunc(user.SignIn)))
+	mux.Handle("/api/user/sign-in/totp", config.CorsMiddleware(http.HandlerFunc(user.SignInTotp)))
+	mux.Handle("/api/user/sign-in/step-up", config.CorsMiddleware(http.HandlerFunc(user.SignInStepUp)))
+	mux.Handle("/api/user/sign-in/passkey/begin", config.CorsMiddleware(http.HandlerFunc(user.BeginPasskeySignIn)))
+	mux.Handle("/api/user/sign-in/passkey/finish", config.CorsMiddleware(http.HandlerFunc(user.FinishPasskeySignIn)))
 	mux.Handle("/api/user/token-sign-in", config.CorsMiddleware(http.HandlerFunc(user.AutoSignIn)))
+	mux.Handle("/api/user/refresh", config.CorsMiddleware(http.HandlerFunc(user.Refresh)))
 	mux.Handle("/api/user/sign-up", config.CorsMiddleware(http.HandlerFunc(user.SignUp)))
-	mux.Handle("/api/user/sign-out", config.CorsMiddleware(http.HandlerFunc(user.SignOut)))
+	mux.Handle("/api/user/password-reset/request", config.CorsMiddleware(http.HandlerFunc(user.RequestPasswordReset)))
+	mux.Handle("/api/user/password-reset/confirm", config.CorsMiddleware(http.HandlerFunc(user.ConfirmPasswordReset)))
+	mux.Handle("/api/user/verify-email", config.CorsMiddleware(http.HandlerFunc(user.VerifyEmail)))
+	mux.Handle("/api/user/change-email", signedIn(user.ChangeEmail))
+	mux.Handle("/api/user/change-password", signedIn(user.ChangePassword))
+	mux.Handle("/api/user/sign-out", signedIn(user.SignOut))
 	mux.Handle("/api/user/fetch-user", config.CorsMiddleware(http.HandlerFunc(user.FetchUser)))
-	mux.Handle("/api/user/update-profile", config.CorsMiddleware(http.HandlerFunc(user.UpdateProfile)))
-	mux.Handle("/api/user/update-name", config.CorsMiddleware(http.HandlerFunc(user.UpdateName)))
-	mux.Handle("/api/user/update-bio", config.CorsMiddleware(http.HandlerFunc(user.UpdateBio)))
+	mux.Handle("/api/user/update-profile", requirePermission(rbac_utils.PermProfileWrite, user.UpdateProfile))
+	mux.Handle("/api/user/update-name", requirePermission(rbac_utils.PermProfileWrite, user.UpdateName))
+	mux.Handle("/api/user/update-bio", requirePermission(rbac_utils.PermProfileWrite, user.UpdateBio))
+	mux.Handle("/api/user/sessions", signedIn(user.ListSessions))
+	mux.Handle("/api/user/sessions/revoke", signedIn(user.RevokeSession))
+	mux.Handle("/api/user/sessions/revoke-others", signedIn(user.RevokeOtherSessions))
+	mux.Handle("/api/user/totp/enroll", signedIn(user.EnrollTotp))
+	mux.Handle("/api/user/totp/confirm", signedIn(user.ConfirmTotp))
+	mux.Handle("/api/user/totp/disable", signedIn(user.DisableTotp))
+	mux.Handle("/api/user/passkeys", signedIn(user.ListPasskeys))
+	mux.Handle("/api/user/passkeys/register/begin", signedIn(user.BeginPasskeyRegistration))
+	mux.Handle("/api/user/passkeys/register/finish", signedIn(user.FinishPasskeyRegistration))
+	mux.Handle("/api/user/passkeys/delete", signedIn(user.DeletePasskey))
+	mux.Handle("/api/user/export", requirePermission(rbac_utils.PermProfileRead, user.ExportData))
+	mux.Handle("/api/user/delete-account", signedIn(user.DeleteAccount))
+	mux.Handle("/api/user/delete-account/cancel", signedIn(user.CancelAccountDeletion))
+	mux.Handle("/api/user/tokens", signedIn(user.ListAccessTokens))
+	mux.Handle("/api/user/tokens/create", signedIn(user.CreateAccessToken))
+	mux.Handle("/api/user/tokens/revoke", signedIn(user.RevokeAccessToken))
+	mux.Handle("/api/user/audit", requirePermission(rbac_utils.PermProfileRead, user.ListAuditEvents))
 }
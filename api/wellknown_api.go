@@ -0,0 +1,11 @@
+package api
+
+import (
+	"github.com/yux77yux/blog-backend/config"
+	"github.com/yux77yux/blog-backend/internal/handlers/wellknown"
+	"net/http"
+)
+
+func WellKnownHandlers(mux *http.ServeMux) {
+	mux.Handle("/.well-known/jwks.json", config.CorsMiddleware(http.HandlerFunc(wellknown.JWKS)))
+}
@@ -5,20 +5,30 @@ import (
 	"net/http"
 
 	"github.com/yux77yux/blog-backend/api"
+	"github.com/yux77yux/blog-backend/internal/handlers/article"
+	"github.com/yux77yux/blog-backend/internal/middleware"
+	"github.com/yux77yux/blog-backend/utils/account_utils"
+	"github.com/yux77yux/blog-backend/utils/article_utils"
+	"github.com/yux77yux/blog-backend/utils/jwt_utils"
 	"github.com/yux77yux/blog-backend/utils/log_utils"
+	"github.com/yux77yux/blog-backend/utils/rbac_utils"
 	"github.com/yux77yux/blog-backend/utils/redis_utils"
 )
 
 func Server() {
 	go redis_utils.ScheduleCleanup()
+	go jwt_utils.ScheduleKeyRotation()
+	go rbac_utils.BootstrapAdmins()
+	go account_utils.SchedulePurge()
+	go article_utils.SchedulePublishing()
 
 	mux := http.NewServeMux()
 	api.UserHandlers(mux)
+	api.AdminHandlers(mux)
+	api.WellKnownHandlers(mux)
+	article.ArticleHandlers(mux)
 
-	//"github.com/yux77yux/blog-backend/internal/handlers/articles"
-	//articles.ArticlesHandlers()
-
-	if err := http.ListenAndServe(":3001", mux); err != nil {
+	if err := http.ListenAndServe(":3001", middleware.ClientIP(mux)); err != nil {
 		log.Println(err)
 		log_utils.Logger.Printf("port has already occupied or others: %v", err)
 	}
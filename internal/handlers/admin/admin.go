@@ -0,0 +1,52 @@
+package admin
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/yux77yux/blog-backend/utils/lockout_utils"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+)
+
+type UnlockTarget struct {
+	Username string `json:"username"`
+	IP       string `json:"ip"`
+}
+
+func UnlockUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	var target UnlockTarget
+	if err := json.NewDecoder(r.Body).Decode(&target); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if target.Username == "" && target.IP == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		response := map[string]string{"err": "username or ip is required"}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	err := lockout_utils.Unlock(target.Username, target.IP)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:admin UnlockUser: ", err)
+		log_utils.Logger.Printf("Error:admin UnlockUser: %v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response := map[string]string{"success": "OK!"}
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,46 @@
+package admin
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/yux77yux/blog-backend/utils/audit_utils"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+)
+
+// ListAuditEvents 查询全部审计事件，可按 ?uid=&actor=&target=&action=&from=&to= 过滤
+func ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	query := r.URL.Query()
+	filter, err := audit_utils.ParseFilter(query)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := map[string]string{"err": audit_utils.ErrFilterInvalid.Error()}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	filter.Uid = query.Get("uid")
+	filter.ActorUid = query.Get("actor")
+	filter.TargetUid = query.Get("target")
+
+	page, err := audit_utils.Query(filter)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:admin ListAuditEvents: ", err)
+		log_utils.Logger.Printf("Error:admin ListAuditEvents: %v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+}
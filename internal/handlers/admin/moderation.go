@@ -0,0 +1,189 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/yux77yux/blog-backend/internal/middleware"
+	"github.com/yux77yux/blog-backend/internal/model"
+	"github.com/yux77yux/blog-backend/utils/audit_utils"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+	"github.com/yux77yux/blog-backend/utils/moderation_utils"
+	"github.com/yux77yux/blog-backend/utils/user_utils"
+)
+
+// 解析请求体并确认目标不是操作者本人，失败时已写好响应
+func moderationTarget(w http.ResponseWriter, r *http.Request) (*model.ModerationTarget, string, bool) {
+	var target model.ModerationTarget
+	if err := json.NewDecoder(r.Body).Decode(&target); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return nil, "", false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if target.Uid == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		response := map[string]string{"err": "uid is required"}
+		json.NewEncoder(w).Encode(response)
+		return nil, "", false
+	}
+
+	operator, _ := middleware.UidFromContext(r.Context())
+	if target.Uid == operator {
+		w.WriteHeader(http.StatusBadRequest)
+		response := map[string]string{"err": "cannot moderate your own account"}
+		json.NewEncoder(w).Encode(response)
+		return nil, "", false
+	}
+
+	return &target, operator, true
+}
+
+func SuspendUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	target, operator, ok := moderationTarget(w, r)
+	if !ok {
+		return
+	}
+
+	err := moderation_utils.Suspend(target.Uid, target.Hours, target.Reason, target.HideContent)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, moderation_utils.ErrHoursInvalid) {
+			status = http.StatusBadRequest
+		}
+		w.WriteHeader(status)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:admin SuspendUser: ", err)
+		log_utils.Logger.Printf("Error:admin SuspendUser: %v", err)
+		return
+	}
+
+	log_utils.Logger.Printf("admin SuspendUser: %s suspended %s for %d hours", operator, target.Uid, target.Hours)
+
+	audit_utils.Record(r, audit_utils.Event{
+		ActorUid:  operator,
+		Action:    audit_utils.ActionSuspend,
+		TargetUid: target.Uid,
+		Target:    target.Reason,
+		After:     strconv.Itoa(target.Hours) + "h",
+	})
+
+	w.WriteHeader(http.StatusOK)
+	response := map[string]string{"success": "OK!"}
+	json.NewEncoder(w).Encode(response)
+}
+
+func BanUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	target, operator, ok := moderationTarget(w, r)
+	if !ok {
+		return
+	}
+
+	err := moderation_utils.Ban(target.Uid, target.Reason, target.HideContent)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:admin BanUser: ", err)
+		log_utils.Logger.Printf("Error:admin BanUser: %v", err)
+		return
+	}
+
+	log_utils.Logger.Printf("admin BanUser: %s banned %s", operator, target.Uid)
+
+	audit_utils.Record(r, audit_utils.Event{
+		ActorUid:  operator,
+		Action:    audit_utils.ActionBan,
+		TargetUid: target.Uid,
+		Target:    target.Reason,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	response := map[string]string{"success": "OK!"}
+	json.NewEncoder(w).Encode(response)
+}
+
+// ReinstateUser 解除暂停或封禁，同时恢复公开内容
+func ReinstateUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	target, operator, ok := moderationTarget(w, r)
+	if !ok {
+		return
+	}
+
+	err := moderation_utils.Reinstate(target.Uid)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:admin ReinstateUser: ", err)
+		log_utils.Logger.Printf("Error:admin ReinstateUser: %v", err)
+		return
+	}
+
+	log_utils.Logger.Printf("admin ReinstateUser: %s reinstated %s", operator, target.Uid)
+
+	audit_utils.Record(r, audit_utils.Event{
+		ActorUid:  operator,
+		Action:    audit_utils.ActionReinstate,
+		TargetUid: target.Uid,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	response := map[string]string{"success": "OK!"}
+	json.NewEncoder(w).Encode(response)
+}
+
+// AccountStatus 查询账号状态，?uid=
+func AccountStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	uid := r.URL.Query().Get("uid")
+	if uid == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		response := map[string]string{"err": "uid is required"}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	status, err := user_utils.FetchAccountStatus(uid)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:admin AccountStatus: ", err)
+		log_utils.Logger.Printf("Error:admin AccountStatus: %v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(status)
+}
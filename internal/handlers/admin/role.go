@@ -0,0 +1,167 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/yux77yux/blog-backend/internal/middleware"
+	"github.com/yux77yux/blog-backend/utils/audit_utils"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+	"github.com/yux77yux/blog-backend/utils/rbac_utils"
+)
+
+type RoleTarget struct {
+	Uid  string `json:"uid"`
+	Role string `json:"role"`
+}
+
+type RolesResponse struct {
+	Uid         string   `json:"uid"`
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+}
+
+func roleError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	message := err.Error()
+	switch {
+	case errors.Is(err, rbac_utils.ErrRoleNotFound):
+		status = http.StatusNotFound
+		message = rbac_utils.ErrRoleNotFound.Error()
+	case errors.Is(err, rbac_utils.ErrUserNotFound):
+		status = http.StatusNotFound
+		message = rbac_utils.ErrUserNotFound.Error()
+	case errors.Is(err, rbac_utils.ErrLastAdmin):
+		status = http.StatusConflict
+		message = rbac_utils.ErrLastAdmin.Error()
+	}
+	w.WriteHeader(status)
+	response := map[string]string{"err": message}
+	json.NewEncoder(w).Encode(response)
+}
+
+// ListRoles 查询某个用户的角色和权限，?uid=
+func ListRoles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	uid := r.URL.Query().Get("uid")
+	if uid == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		response := map[string]string{"err": "uid is required"}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	grants, err := rbac_utils.FetchGrants(uid)
+	if err != nil {
+		roleError(w, err)
+		log.Println("Error:admin ListRoles: ", err)
+		log_utils.Logger.Printf("Error:admin ListRoles: %v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(RolesResponse{
+		Uid:         uid,
+		Roles:       grants.Roles,
+		Permissions: grants.Permissions,
+	})
+}
+
+func GrantRole(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	var target RoleTarget
+	if err := json.NewDecoder(r.Body).Decode(&target); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if target.Uid == "" || target.Role == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		response := map[string]string{"err": "uid and role are required"}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	grantedBy, _ := middleware.UidFromContext(r.Context())
+	err := rbac_utils.GrantRole(target.Uid, target.Role, grantedBy)
+	if err != nil {
+		roleError(w, err)
+		log.Println("Error:admin GrantRole: ", err)
+		log_utils.Logger.Printf("Error:admin GrantRole: %v", err)
+		return
+	}
+
+	log_utils.Logger.Printf("admin GrantRole: %s granted %s to %s", grantedBy, target.Role, target.Uid)
+
+	audit_utils.Record(r, audit_utils.Event{
+		ActorUid:  grantedBy,
+		Action:    audit_utils.ActionRoleGrant,
+		TargetUid: target.Uid,
+		Target:    target.Role,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	response := map[string]string{"success": "OK!"}
+	json.NewEncoder(w).Encode(response)
+}
+
+func RevokeRole(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	var target RoleTarget
+	if err := json.NewDecoder(r.Body).Decode(&target); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if target.Uid == "" || target.Role == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		response := map[string]string{"err": "uid and role are required"}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	err := rbac_utils.RevokeRole(target.Uid, target.Role)
+	if err != nil {
+		roleError(w, err)
+		log.Println("Error:admin RevokeRole: ", err)
+		log_utils.Logger.Printf("Error:admin RevokeRole: %v", err)
+		return
+	}
+
+	revokedBy, _ := middleware.UidFromContext(r.Context())
+	log_utils.Logger.Printf("admin RevokeRole: %s revoked %s from %s", revokedBy, target.Role, target.Uid)
+
+	audit_utils.Record(r, audit_utils.Event{
+		ActorUid:  revokedBy,
+		Action:    audit_utils.ActionRoleRevoke,
+		TargetUid: target.Uid,
+		Target:    target.Role,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	response := map[string]string{"success": "OK!"}
+	json.NewEncoder(w).Encode(response)
+}
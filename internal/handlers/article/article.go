@@ -0,0 +1,310 @@
+package article
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/yux77yux/blog-backend/internal/middleware"
+	"github.com/yux77yux/blog-backend/internal/model"
+	"github.com/yux77yux/blog-backend/utils/article_utils"
+	"github.com/yux77yux/blog-backend/utils/ipinfo"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+	"github.com/yux77yux/blog-backend/utils/markdown_utils"
+	"github.com/yux77yux/blog-backend/utils/rbac_utils"
+)
+
+// 校验类错误返回 400，找不到返回 404，状态冲突返回 409，其余 500
+func articleError(w http.ResponseWriter, name string, err error) {
+	status := http.StatusInternalServerError
+	message := err.Error()
+	switch {
+	case errors.Is(err, article_utils.ErrArticleNotFound):
+		status = http.StatusNotFound
+		message = article_utils.ErrArticleNotFound.Error()
+	case errors.Is(err, article_utils.ErrRevisionNotFound):
+		status = http.StatusNotFound
+		message = article_utils.ErrRevisionNotFound.Error()
+	case errors.Is(err, article_utils.ErrTagNotFound):
+		status = http.StatusNotFound
+		message = article_utils.ErrTagNotFound.Error()
+	case errors.Is(err, article_utils.ErrAlreadyPublished):
+		status = http.StatusConflict
+		message = article_utils.ErrAlreadyPublished.Error()
+	default:
+		for _, known := range []error{
+			article_utils.ErrTitleRequired,
+			article_utils.ErrTitleTooLong,
+			article_utils.ErrContentTooLong,
+			article_utils.ErrScheduleInPast,
+			article_utils.ErrDiffModeInvalid,
+			article_utils.ErrTooManyTags,
+			article_utils.ErrTagTooLong,
+		} {
+			if errors.Is(err, known) {
+				status = http.StatusBadRequest
+				message = known.Error()
+				break
+			}
+		}
+	}
+
+	w.WriteHeader(status)
+	response := map[string]string{"err": message}
+	json.NewEncoder(w).Encode(response)
+	if status == http.StatusInternalServerError {
+		log.Println("Error:article "+name+": ", err)
+		log_utils.Logger.Printf("Error:article %s: %v", name, err)
+	}
+}
+
+// 按客户端 IP 推断作者所在时区，查不到时使用 UTC
+func articleTimezone(r *http.Request) string {
+	info, err := ipinfo.GetIPInfo(ipinfo.GetClientIP(r))
+	if err != nil {
+		log_utils.Logger.Printf("Error:article articleTimezone: %v", err)
+		return "UTC"
+	}
+	if _, err := time.LoadLocation(info.Timezone); info.Timezone == "" || err != nil {
+		return "UTC"
+	}
+	return info.Timezone
+}
+
+// 作者本人或拥有 permission 的用户可以操作（包括草稿），其他人看不到草稿，失败时已写好响应
+func authorize(w http.ResponseWriter, r *http.Request, uuid string, permission string) (*model.Article, string, bool) {
+	uid, ok := middleware.CallerUid(w, r, "")
+	if !ok {
+		return nil, "", false
+	}
+
+	article, _, err := article_utils.FetchArticle(uuid)
+	if err != nil {
+		articleError(w, "authorize", err)
+		return nil, "", false
+	}
+
+	if article.Uid != uid && !middleware.HasPermission(r.Context(), permission) {
+		if article.Status == article_utils.StatusDraft {
+			articleError(w, "authorize", article_utils.ErrArticleNotFound)
+			return nil, "", false
+		}
+		w.WriteHeader(http.StatusForbidden)
+		response := map[string]string{"err": "only the author can modify this article"}
+		json.NewEncoder(w).Encode(response)
+		log_utils.Logger.Printf("Error:article authorize: %s tried to modify %s", uid, uuid)
+		return nil, "", false
+	}
+	return article, uid, true
+}
+
+func pageParams(r *http.Request) (int, int) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("pageSize"))
+	return page, pageSize
+}
+
+func CreateArticle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, article_utils.MaxContentBytes*2)
+	var edit model.ArticleEdit
+	if err := json.NewDecoder(r.Body).Decode(&edit); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	uid, ok := middleware.CallerUid(w, r, "")
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	article, err := article_utils.AddArticle(uid, &edit, articleTimezone(r))
+	if err != nil {
+		articleError(w, "CreateArticle", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(article)
+}
+
+// FetchArticle 公开读取已发布的文章，同时返回 Markdown 原文和渲染后的 HTML，?uuid=
+func FetchArticle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	article, hidden, err := article_utils.FetchArticle(r.URL.Query().Get("uuid"))
+	if err != nil {
+		articleError(w, "FetchArticle", err)
+		return
+	}
+	// 草稿和被隐藏作者的文章对外表现为不存在
+	if hidden || article.Status != article_utils.StatusPublished {
+		articleError(w, "FetchArticle", article_utils.ErrArticleNotFound)
+		return
+	}
+
+	// 渲染失败时仍然返回原文，由客户端自行处理
+	if rendered, err := markdown_utils.Render(article.Content); err != nil {
+		log_utils.Logger.Printf("Error:article FetchArticle Render: %v", err)
+	} else {
+		article.ContentHtml = rendered.Html
+		article.Toc = rendered.Toc
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(article)
+}
+
+// ListArticles 公开的文章列表，?uid=&page=&pageSize=
+func ListArticles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	page, pageSize := pageParams(r)
+	articles, err := article_utils.ListArticles(article_utils.Filter{
+		Uid:      r.URL.Query().Get("uid"),
+		Page:     page,
+		PageSize: pageSize,
+	})
+	if err != nil {
+		articleError(w, "ListArticles", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(articles)
+}
+
+// ListMyArticles 当前用户的全部文章，包括草稿，?page=&pageSize=
+func ListMyArticles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	uid, ok := middleware.CallerUid(w, r, "")
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	page, pageSize := pageParams(r)
+	articles, err := article_utils.ListArticles(article_utils.Filter{
+		Uid:           uid,
+		IncludeDrafts: true,
+		Page:          page,
+		PageSize:      pageSize,
+	})
+	if err != nil {
+		articleError(w, "ListMyArticles", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(articles)
+}
+
+// EditArticle 读取待编辑的文章（包括草稿），?uuid=
+func EditArticle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	article, _, ok := authorize(w, r, r.URL.Query().Get("uuid"), rbac_utils.PermArticleEditAny)
+	if !ok {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(article)
+}
+
+func UpdateArticle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, article_utils.MaxContentBytes*2)
+	var edit model.ArticleEdit
+	if err := json.NewDecoder(r.Body).Decode(&edit); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_, uid, ok := authorize(w, r, edit.Uuid, rbac_utils.PermArticleEditAny)
+	if !ok {
+		return
+	}
+
+	article, err := article_utils.UpdateArticle(&edit, uid)
+	if err != nil {
+		articleError(w, "UpdateArticle", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(article)
+}
+
+func DeleteArticle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	var target model.ArticleID
+	if err := json.NewDecoder(r.Body).Decode(&target); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_, uid, ok := authorize(w, r, target.Uuid, rbac_utils.PermArticleDeleteAny)
+	if !ok {
+		return
+	}
+
+	if err := article_utils.DeleteArticle(target.Uuid); err != nil {
+		articleError(w, "DeleteArticle", err)
+		return
+	}
+
+	log_utils.Logger.Printf("article DeleteArticle: %s deleted %s", uid, target.Uuid)
+
+	w.WriteHeader(http.StatusOK)
+	response := map[string]string{"success": "OK!"}
+	json.NewEncoder(w).Encode(response)
+}
@@ -2,9 +2,32 @@ package article
 
 import (
 	"net/http"
+
+	"github.com/yux77yux/blog-backend/config"
+	"github.com/yux77yux/blog-backend/internal/middleware"
+	"github.com/yux77yux/blog-backend/utils/rbac_utils"
 )
 
+// 写文章需要 article:write，修改或删除他人的文章另外需要 edit_any / delete_any
+func writer(handler http.HandlerFunc) http.Handler {
+	return config.CorsMiddleware(middleware.Authenticate(middleware.RequirePermission(rbac_utils.PermArticleWrite)(handler)))
+}
+
 func ArticleHandlers(mux *http.ServeMux) {
-	//"github.com/yux77yux/blog-backend/config"
-	//mux.Handle("/api/article/", config.CorsMiddleware(http.HandlerFunc()))
+	mux.Handle("/api/article/fetch", config.CorsMiddleware(http.HandlerFunc(FetchArticle)))
+	mux.Handle("/api/article/list", config.CorsMiddleware(http.HandlerFunc(ListArticles)))
+	mux.Handle("/api/article/tags", config.CorsMiddleware(http.HandlerFunc(ListTags)))
+	mux.Handle("/api/article/tag", config.CorsMiddleware(http.HandlerFunc(ListTagArticles)))
+	mux.Handle("/api/article/mine", writer(ListMyArticles))
+	mux.Handle("/api/article/edit", writer(EditArticle))
+	mux.Handle("/api/article/create", writer(CreateArticle))
+	mux.Handle("/api/article/update", writer(UpdateArticle))
+	mux.Handle("/api/article/delete", writer(DeleteArticle))
+	mux.Handle("/api/article/publish", writer(PublishArticle))
+	mux.Handle("/api/article/unpublish", writer(UnpublishArticle))
+	mux.Handle("/api/article/schedule", writer(ScheduleArticle))
+	mux.Handle("/api/article/revisions", writer(ListRevisions))
+	mux.Handle("/api/article/revision", writer(FetchRevision))
+	mux.Handle("/api/article/diff", writer(DiffRevisions))
+	mux.Handle("/api/article/restore", writer(RestoreRevision))
 }
@@ -0,0 +1,106 @@
+package article
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/yux77yux/blog-backend/internal/model"
+	"github.com/yux77yux/blog-backend/utils/article_utils"
+	"github.com/yux77yux/blog-backend/utils/rbac_utils"
+)
+
+func PublishArticle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	var target model.ArticleID
+	if err := json.NewDecoder(r.Body).Decode(&target); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if _, _, ok := authorize(w, r, target.Uuid, rbac_utils.PermArticleEditAny); !ok {
+		return
+	}
+
+	article, err := article_utils.PublishArticle(target.Uuid)
+	if err != nil {
+		articleError(w, "PublishArticle", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(article)
+}
+
+// UnpublishArticle 撤回为草稿，管理员可以用 edit_any 下架他人的文章
+func UnpublishArticle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	var target model.ArticleID
+	if err := json.NewDecoder(r.Body).Decode(&target); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if _, _, ok := authorize(w, r, target.Uuid, rbac_utils.PermArticleEditAny); !ok {
+		return
+	}
+
+	article, err := article_utils.UnpublishArticle(target.Uuid)
+	if err != nil {
+		articleError(w, "UnpublishArticle", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(article)
+}
+
+// ScheduleArticle 安排草稿定时发布，取消安排使用 UnpublishArticle
+func ScheduleArticle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	var schedule model.ArticleSchedule
+	if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	publishAt, err := time.Parse(time.RFC3339, schedule.PublishAt)
+	if err != nil {
+		http.Error(w, "publishAt must be an RFC3339 time", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if _, _, ok := authorize(w, r, schedule.Uuid, rbac_utils.PermArticleEditAny); !ok {
+		return
+	}
+
+	article, err := article_utils.ScheduleArticle(schedule.Uuid, publishAt)
+	if err != nil {
+		articleError(w, "ScheduleArticle", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(article)
+}
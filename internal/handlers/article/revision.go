@@ -0,0 +1,139 @@
+package article
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/yux77yux/blog-backend/internal/model"
+	"github.com/yux77yux/blog-backend/utils/article_utils"
+	"github.com/yux77yux/blog-backend/utils/rbac_utils"
+)
+
+// ListRevisions 文章的版本列表，只有作者和拥有 edit_any 的用户可以查看，?uuid=&page=&pageSize=
+func ListRevisions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	uuid := r.URL.Query().Get("uuid")
+	if _, _, ok := authorize(w, r, uuid, rbac_utils.PermArticleEditAny); !ok {
+		return
+	}
+
+	page, pageSize := pageParams(r)
+	revisions, err := article_utils.FetchRevisions(uuid, page, pageSize)
+	if err != nil {
+		articleError(w, "ListRevisions", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(revisions)
+}
+
+// FetchRevision 某个版本的完整内容，?uuid=&revision=
+func FetchRevision(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	number, err := strconv.Atoi(r.URL.Query().Get("revision"))
+	if err != nil {
+		http.Error(w, "revision must be a number", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	uuid := r.URL.Query().Get("uuid")
+	if _, _, ok := authorize(w, r, uuid, rbac_utils.PermArticleEditAny); !ok {
+		return
+	}
+
+	revision, err := article_utils.FetchRevision(uuid, number)
+	if err != nil {
+		articleError(w, "FetchRevision", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(revision)
+}
+
+// DiffRevisions 比较两个版本，?uuid=&from=&to=&mode=line|word，mode 默认 line
+func DiffRevisions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	from, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil {
+		http.Error(w, "from must be a number", http.StatusBadRequest)
+		return
+	}
+	to, err := strconv.Atoi(r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, "to must be a number", http.StatusBadRequest)
+		return
+	}
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = article_utils.DiffLine
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	uuid := r.URL.Query().Get("uuid")
+	if _, _, ok := authorize(w, r, uuid, rbac_utils.PermArticleEditAny); !ok {
+		return
+	}
+
+	diff, err := article_utils.DiffRevisions(uuid, from, to, mode)
+	if err != nil {
+		articleError(w, "DiffRevisions", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(diff)
+}
+
+// RestoreRevision 恢复到某个版本，恢复本身也会生成一个新版本
+func RestoreRevision(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	var restore model.ArticleRestore
+	if err := json.NewDecoder(r.Body).Decode(&restore); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_, uid, ok := authorize(w, r, restore.Uuid, rbac_utils.PermArticleEditAny)
+	if !ok {
+		return
+	}
+
+	article, err := article_utils.RestoreRevision(restore.Uuid, restore.Revision, uid)
+	if err != nil {
+		articleError(w, "RestoreRevision", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(article)
+}
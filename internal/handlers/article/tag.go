@@ -0,0 +1,62 @@
+package article
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/yux77yux/blog-backend/internal/model"
+	"github.com/yux77yux/blog-backend/utils/article_utils"
+)
+
+// ListTags 按已发布文章数倒序的标签列表，?limit=
+func ListTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	tags, err := article_utils.FetchTags(limit)
+	if err != nil {
+		articleError(w, "ListTags", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tags)
+}
+
+// ListTagArticles 标签页，返回标签与该标签下已发布的文章，?slug=&page=&pageSize=
+func ListTagArticles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	tag, err := article_utils.FetchTag(r.URL.Query().Get("slug"))
+	if err != nil {
+		articleError(w, "ListTagArticles", err)
+		return
+	}
+
+	page, pageSize := pageParams(r)
+	articles, err := article_utils.ListArticles(article_utils.Filter{
+		Tag:      tag.Slug,
+		Page:     page,
+		PageSize: pageSize,
+	})
+	if err != nil {
+		articleError(w, "ListTagArticles", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(model.TagPage{Tag: tag, ArticlePage: *articles})
+}
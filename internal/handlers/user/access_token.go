@@ -0,0 +1,154 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/yux77yux/blog-backend/internal/middleware"
+	"github.com/yux77yux/blog-backend/internal/model"
+	"github.com/yux77yux/blog-backend/utils/audit_utils"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+	"github.com/yux77yux/blog-backend/utils/pat_utils"
+	"github.com/yux77yux/blog-backend/utils/user_utils"
+)
+
+func ListAccessTokens(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	uid, ok := middleware.CallerUid(w, r, "")
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	tokens, err := user_utils.FetchAccessTokens(uid)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user ListAccessTokens: ", err)
+		log_utils.Logger.Printf("Error:user ListAccessTokens: %v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// CreateAccessToken 明文令牌只在本次响应中返回
+func CreateAccessToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	var request model.NewAccessToken
+	jsonDecoder(w, r, &request)
+
+	uid, ok := middleware.CallerUid(w, r, "")
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	token, accessToken, err := pat_utils.Create(uid, &request)
+	if err != nil {
+		status := http.StatusInternalServerError
+		message := "create access token failed"
+		for _, known := range []error{
+			pat_utils.ErrNameInvalid,
+			pat_utils.ErrScopesRequired,
+			pat_utils.ErrScopeNotHeld,
+			pat_utils.ErrTTLInvalid,
+			pat_utils.ErrTooManyTokens,
+		} {
+			if errors.Is(err, known) {
+				status = http.StatusBadRequest
+				message = err.Error()
+				break
+			}
+		}
+		w.WriteHeader(status)
+		response := map[string]string{"err": message}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user CreateAccessToken: ", err)
+		log_utils.Logger.Printf("Error:user CreateAccessToken: %v", err)
+		return
+	}
+
+	audit_utils.Record(r, audit_utils.Event{
+		ActorUid:  uid,
+		Action:    audit_utils.ActionTokenCreate,
+		TargetUid: uid,
+		Target:    accessToken.TokenId,
+		After:     strings.Join(accessToken.Scopes, " "),
+	})
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(model.CreatedAccessToken{
+		AccessToken: accessToken,
+		Token:       token,
+	})
+}
+
+func RevokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	var target model.AccessTokenID
+	jsonDecoder(w, r, &target)
+
+	uid, ok := middleware.CallerUid(w, r, "")
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if target.TokenId == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		response := map[string]string{"err": "tokenId is required"}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	deleted, err := user_utils.DeleteAccessToken(uid, target.TokenId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user RevokeAccessToken: ", err)
+		log_utils.Logger.Printf("Error:user RevokeAccessToken: %v", err)
+		return
+	}
+	if !deleted {
+		w.WriteHeader(http.StatusNotFound)
+		response := map[string]string{"err": "access token not found"}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	audit_utils.Record(r, audit_utils.Event{
+		ActorUid:  uid,
+		Action:    audit_utils.ActionTokenRevoke,
+		TargetUid: uid,
+		Target:    target.TokenId,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	response := map[string]string{"success": "OK!"}
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,192 @@
+package user
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/yux77yux/blog-backend/internal/middleware"
+	"github.com/yux77yux/blog-backend/internal/model"
+	"github.com/yux77yux/blog-backend/utils/account_utils"
+	"github.com/yux77yux/blog-backend/utils/audit_utils"
+	"github.com/yux77yux/blog-backend/utils/ipinfo"
+	"github.com/yux77yux/blog-backend/utils/lockout_utils"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+	"github.com/yux77yux/blog-backend/utils/redis_utils"
+	"github.com/yux77yux/blog-backend/utils/user_utils"
+)
+
+// 同一用户两次导出的最短间隔
+const exportThrottle = time.Minute * 10
+
+// ExportData 返回包含资料、文章和上传文件列表的 zip
+func ExportData(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	uid, ok := middleware.CallerUid(w, r, "")
+	if !ok {
+		return
+	}
+
+	allowed, err := redis_utils.AcquireThrottle(fmt.Sprintf("data_export:%s", uid), exportThrottle)
+	if err != nil {
+		log_utils.Logger.Printf("Error:user ExportData AcquireThrottle: %v", err)
+	}
+	if err == nil && !allowed {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", strconv.Itoa(int(exportThrottle.Seconds())))
+		w.WriteHeader(http.StatusTooManyRequests)
+		response := map[string]string{"err": "export was requested recently, try again later"}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	// 先写入内存，出错时还能返回 JSON 错误
+	var buffer bytes.Buffer
+	if err := account_utils.Export(uid, &buffer); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": "export failed"}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user ExportData: ", err)
+		log_utils.Logger.Printf("Error:user ExportData: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"blog-export-%s.zip\"", uid))
+	w.Header().Set("Content-Length", strconv.Itoa(buffer.Len()))
+	w.WriteHeader(http.StatusOK)
+	buffer.WriteTo(w)
+}
+
+// DeleteAccount 需要当前密码，宽限期内可以撤销
+func DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	var request model.DeleteAccount
+	jsonDecoder(w, r, &request)
+
+	uid, ok := middleware.CallerUid(w, r, "")
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// 与修改密码共用锁定计数，避免借已登录的会话穷举密码
+	ip := ipinfo.GetClientIP(r)
+	account := lockout_utils.AccountByUid(uid)
+
+	retryAfter, err := lockout_utils.Check(account, ip)
+	if err != nil {
+		log_utils.Logger.Printf("Error:user DeleteAccount lockout Check: %v", err)
+	}
+	if retryAfter > 0 {
+		tooManyAttempts(w, retryAfter)
+		return
+	}
+
+	matched, err := user_utils.CheckPassword(uid, request.Password)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user DeleteAccount: ", err)
+		log_utils.Logger.Printf("Error:user DeleteAccount: %v", err)
+		return
+	}
+	if !matched {
+		retryAfter, err := lockout_utils.RecordFailure(account, ip)
+		if err != nil {
+			log_utils.Logger.Printf("Error:user DeleteAccount lockout RecordFailure: %v", err)
+		}
+		if retryAfter > 0 {
+			tooManyAttempts(w, retryAfter)
+			return
+		}
+
+		w.WriteHeader(http.StatusForbidden)
+		response := map[string]string{"err": "password is incorrect"}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if err := lockout_utils.RecordSuccess(account); err != nil {
+		log_utils.Logger.Printf("Error:user DeleteAccount lockout RecordSuccess: %v", err)
+	}
+
+	deleteAfter, err := account_utils.RequestDeletion(uid)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user DeleteAccount: ", err)
+		log_utils.Logger.Printf("Error:user DeleteAccount: %v", err)
+		return
+	}
+
+	audit_utils.Record(r, audit_utils.Event{
+		ActorUid:  uid,
+		Action:    audit_utils.ActionDeletionRequest,
+		TargetUid: uid,
+		After:     deleteAfter,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	response := map[string]string{"success": "OK!", "deleteAfter": deleteAfter}
+	json.NewEncoder(w).Encode(response)
+}
+
+func CancelAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	uid, ok := middleware.CallerUid(w, r, "")
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	cancelled, err := account_utils.CancelDeletion(uid)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user CancelAccountDeletion: ", err)
+		log_utils.Logger.Printf("Error:user CancelAccountDeletion: %v", err)
+		return
+	}
+	if !cancelled {
+		w.WriteHeader(http.StatusNotFound)
+		response := map[string]string{"err": "account deletion is not scheduled"}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	audit_utils.Record(r, audit_utils.Event{
+		ActorUid:  uid,
+		Action:    audit_utils.ActionDeletionCancel,
+		TargetUid: uid,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	response := map[string]string{"success": "OK!"}
+	json.NewEncoder(w).Encode(response)
+}
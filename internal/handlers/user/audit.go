@@ -0,0 +1,49 @@
+package user
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/yux77yux/blog-backend/internal/middleware"
+	"github.com/yux77yux/blog-backend/utils/audit_utils"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+)
+
+// ListAuditEvents 返回当前用户作为执行者或被操作者的审计事件，?action=&from=&to=&page=&pageSize=
+func ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	uid, ok := middleware.CallerUid(w, r, "")
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	filter, err := audit_utils.ParseFilter(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := map[string]string{"err": audit_utils.ErrFilterInvalid.Error()}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	filter.Uid = uid
+
+	page, err := audit_utils.Query(filter)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user ListAuditEvents: ", err)
+		log_utils.Logger.Printf("Error:user ListAuditEvents: %v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+}
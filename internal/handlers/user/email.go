@@ -0,0 +1,193 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/yux77yux/blog-backend/internal/middleware"
+	"github.com/yux77yux/blog-backend/internal/model"
+	"github.com/yux77yux/blog-backend/utils/audit_utils"
+	"github.com/yux77yux/blog-backend/utils/email_utils"
+	"github.com/yux77yux/blog-backend/utils/ipinfo"
+	"github.com/yux77yux/blog-backend/utils/lockout_utils"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+	"github.com/yux77yux/blog-backend/utils/user_utils"
+)
+
+// ChangeEmail 需要当前密码，新邮箱验证通过后才替换旧邮箱
+func ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	var request model.ChangeEmail
+	jsonDecoder(w, r, &request)
+
+	uid, ok := middleware.CallerUid(w, r, "")
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// 与修改密码共用锁定计数，避免借已登录的会话穷举密码后改绑邮箱
+	ip := ipinfo.GetClientIP(r)
+	account := lockout_utils.AccountByUid(uid)
+
+	retryAfter, err := lockout_utils.Check(account, ip)
+	if err != nil {
+		log_utils.Logger.Printf("Error:user ChangeEmail lockout Check: %v", err)
+	}
+	if retryAfter > 0 {
+		tooManyAttempts(w, retryAfter)
+		return
+	}
+
+	matched, err := user_utils.CheckPassword(uid, request.Password)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user ChangeEmail: ", err)
+		log_utils.Logger.Printf("Error:user ChangeEmail: %v", err)
+		return
+	}
+	if !matched {
+		retryAfter, err := lockout_utils.RecordFailure(account, ip)
+		if err != nil {
+			log_utils.Logger.Printf("Error:user ChangeEmail lockout RecordFailure: %v", err)
+		}
+		if retryAfter > 0 {
+			tooManyAttempts(w, retryAfter)
+			return
+		}
+
+		w.WriteHeader(http.StatusForbidden)
+		response := map[string]string{"err": "password is incorrect"}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if err := lockout_utils.RecordSuccess(account); err != nil {
+		log_utils.Logger.Printf("Error:user ChangeEmail lockout RecordSuccess: %v", err)
+	}
+
+	oldEmail, _, err := user_utils.FetchEmail(uid)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user ChangeEmail: ", err)
+		log_utils.Logger.Printf("Error:user ChangeEmail: %v", err)
+		return
+	}
+
+	email, err := user_utils.SetPendingEmail(uid, request.Email)
+	if err != nil {
+		status := http.StatusInternalServerError
+		message := "change email failed"
+		switch {
+		case errors.Is(err, user_utils.ErrEmailInvalid):
+			status = http.StatusBadRequest
+			message = user_utils.ErrEmailInvalid.Error()
+		case errors.Is(err, user_utils.ErrEmailTaken):
+			status = http.StatusConflict
+			message = user_utils.ErrEmailTaken.Error()
+		}
+		w.WriteHeader(status)
+		response := map[string]string{"err": message}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user ChangeEmail: ", err)
+		log_utils.Logger.Printf("Error:user ChangeEmail: %v", err)
+		return
+	}
+
+	err = email_utils.SendVerification(uid, email)
+	if errors.Is(err, email_utils.ErrVerifyThrottled) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(email_utils.VerifyThrottle.Seconds())))
+		w.WriteHeader(http.StatusTooManyRequests)
+		response := map[string]string{"err": email_utils.ErrVerifyThrottled.Error()}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": "send verification email failed"}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user ChangeEmail SendVerification: ", err)
+		log_utils.Logger.Printf("Error:user ChangeEmail SendVerification: %v", err)
+		return
+	}
+
+	if oldEmail != "" && oldEmail != email {
+		if err := email_utils.NotifyEmailChange(oldEmail, email); err != nil {
+			log.Println("Error:user ChangeEmail NotifyEmailChange: ", err)
+			log_utils.Logger.Printf("Error:user ChangeEmail NotifyEmailChange: %v", err)
+		}
+	}
+
+	audit_utils.Record(r, audit_utils.Event{
+		ActorUid:  uid,
+		Action:    audit_utils.ActionEmailChange,
+		TargetUid: uid,
+		Before:    oldEmail,
+		After:     email,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	response := map[string]string{"success": "A verification link has been sent to the new email"}
+	json.NewEncoder(w).Encode(response)
+}
+
+func VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	var request model.EmailVerification
+	jsonDecoder(w, r, &request)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	uid, err := email_utils.ConfirmVerification(request.Token)
+	if err != nil {
+		status := http.StatusInternalServerError
+		message := "verify email failed"
+		switch {
+		case errors.Is(err, email_utils.ErrVerifyTokenInvalid):
+			status = http.StatusUnauthorized
+			message = email_utils.ErrVerifyTokenInvalid.Error()
+		case errors.Is(err, user_utils.ErrEmailTaken):
+			status = http.StatusConflict
+			message = user_utils.ErrEmailTaken.Error()
+		}
+		w.WriteHeader(status)
+		response := map[string]string{"err": message}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user VerifyEmail: ", err)
+		log_utils.Logger.Printf("Error:user VerifyEmail: %v", err)
+		return
+	}
+
+	email, _, err := user_utils.FetchEmail(uid)
+	if err != nil {
+		log_utils.Logger.Printf("Error:user VerifyEmail FetchEmail: %v", err)
+	}
+	audit_utils.Record(r, audit_utils.Event{
+		ActorUid:  uid,
+		Action:    audit_utils.ActionEmailVerify,
+		TargetUid: uid,
+		After:     email,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	response := map[string]string{"success": "OK!"}
+	json.NewEncoder(w).Encode(response)
+}
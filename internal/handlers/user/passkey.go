@@ -0,0 +1,225 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/yux77yux/blog-backend/internal/middleware"
+	"github.com/yux77yux/blog-backend/internal/model"
+	"github.com/yux77yux/blog-backend/utils/audit_utils"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+	"github.com/yux77yux/blog-backend/utils/redis_utils"
+	"github.com/yux77yux/blog-backend/utils/user_utils"
+	"github.com/yux77yux/blog-backend/utils/webauthn_utils"
+)
+
+type PasskeyLoginOptions struct {
+	SessionId string                        `json:"sessionId"`
+	Options   *protocol.CredentialAssertion `json:"options"`
+}
+
+func BeginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	uid, ok := middleware.CallerUid(w, r, "")
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	creation, err := webauthn_utils.BeginRegistration(uid)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user BeginPasskeyRegistration: ", err)
+		log_utils.Logger.Printf("Error:user BeginPasskeyRegistration: %v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(creation)
+}
+
+// FinishPasskeyRegistration 请求体为浏览器返回的 PublicKeyCredential，名称通过 ?name= 传入
+func FinishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	uid, ok := middleware.CallerUid(w, r, "")
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	passkey, err := webauthn_utils.FinishRegistration(uid, r.URL.Query().Get("name"), r.Body)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, webauthn_utils.ErrCeremonyExpired) {
+			status = http.StatusConflict
+		}
+		w.WriteHeader(status)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user FinishPasskeyRegistration: ", err)
+		log_utils.Logger.Printf("Error:user FinishPasskeyRegistration: %v", err)
+		return
+	}
+
+	audit_utils.Record(r, audit_utils.Event{
+		ActorUid:  uid,
+		Action:    audit_utils.ActionPasskeyAdd,
+		TargetUid: uid,
+		Target:    passkey.CredentialId,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(passkey)
+}
+
+func BeginPasskeySignIn(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	assertion, sessionId, err := webauthn_utils.BeginLogin()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user BeginPasskeySignIn: ", err)
+		log_utils.Logger.Printf("Error:user BeginPasskeySignIn: %v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(PasskeyLoginOptions{
+		SessionId: sessionId,
+		Options:   assertion,
+	})
+}
+
+// FinishPasskeySignIn 请求体为浏览器返回的断言，BeginPasskeySignIn 返回的 sessionId 通过 ?session= 传入
+func FinishPasskeySignIn(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	uid, err := webauthn_utils.FinishLogin(r.URL.Query().Get("session"), r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		response := map[string]string{"err": "passkey sign in failed"}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user FinishPasskeySignIn: ", err)
+		log_utils.Logger.Printf("Error:user FinishPasskeySignIn: %v", err)
+		return
+	}
+
+	if accountBlocked(w, uid) {
+		return
+	}
+
+	var userInfo *model.UserIncidental
+	userInfo, err = redis_utils.GetUserFromRedis(uid)
+	if err != nil {
+		userInfo, err = user_utils.FetchUser(uid)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			response := map[string]string{"err": "sign in failed"}
+			json.NewEncoder(w).Encode(response)
+			log.Println("Error:user FinishPasskeySignIn FetchUser: ", err)
+			log_utils.Logger.Printf("Error:user FinishPasskeySignIn FetchUser: %v", err)
+			return
+		}
+	}
+
+	// 通行密钥本身要求用户验证，不再走 TOTP
+	completeSignIn(w, r, userInfo)
+}
+
+func ListPasskeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	uid, ok := middleware.CallerUid(w, r, "")
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_, passkeys, err := user_utils.FetchPasskeys(uid)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user ListPasskeys: ", err)
+		log_utils.Logger.Printf("Error:user ListPasskeys: %v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(passkeys)
+}
+
+func DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	var target model.PasskeyID
+	jsonDecoder(w, r, &target)
+
+	uid, ok := middleware.CallerUid(w, r, "")
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := user_utils.DeletePasskey(uid, target.CredentialId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user DeletePasskey: ", err)
+		log_utils.Logger.Printf("Error:user DeletePasskey: %v", err)
+		return
+	}
+
+	audit_utils.Record(r, audit_utils.Event{
+		ActorUid:  uid,
+		Action:    audit_utils.ActionPasskeyDelete,
+		TargetUid: uid,
+		Target:    target.CredentialId,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	response := map[string]string{"success": "OK!"}
+	json.NewEncoder(w).Encode(response)
+}
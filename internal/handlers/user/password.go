@@ -0,0 +1,170 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/yux77yux/blog-backend/internal/middleware"
+	"github.com/yux77yux/blog-backend/internal/model"
+	"github.com/yux77yux/blog-backend/utils/audit_utils"
+	"github.com/yux77yux/blog-backend/utils/ipinfo"
+	"github.com/yux77yux/blog-backend/utils/lockout_utils"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+	"github.com/yux77yux/blog-backend/utils/reset_utils"
+	"github.com/yux77yux/blog-backend/utils/user_utils"
+)
+
+// ChangePassword 需要旧密码，成功后除当前会话外全部下线
+func ChangePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	var request model.ChangePassword
+	jsonDecoder(w, r, &request)
+
+	uid, ok := middleware.CallerUid(w, r, "")
+	if !ok {
+		return
+	}
+	sid, _ := middleware.SidFromContext(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// 旧密码错误与登录失败共用锁定计数，避免借已登录的会话穷举密码
+	ip := ipinfo.GetClientIP(r)
+	account := lockout_utils.AccountByUid(uid)
+
+	retryAfter, err := lockout_utils.Check(account, ip)
+	if err != nil {
+		log_utils.Logger.Printf("Error:user ChangePassword lockout Check: %v", err)
+	}
+	if retryAfter > 0 {
+		tooManyAttempts(w, retryAfter)
+		return
+	}
+
+	matched, err := user_utils.CheckPassword(uid, request.OldPassword)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user ChangePassword: ", err)
+		log_utils.Logger.Printf("Error:user ChangePassword: %v", err)
+		return
+	}
+	if !matched {
+		retryAfter, err := lockout_utils.RecordFailure(account, ip)
+		if err != nil {
+			log_utils.Logger.Printf("Error:user ChangePassword lockout RecordFailure: %v", err)
+		}
+		if retryAfter > 0 {
+			tooManyAttempts(w, retryAfter)
+			return
+		}
+
+		w.WriteHeader(http.StatusForbidden)
+		response := map[string]string{"err": "old password is incorrect"}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if err := lockout_utils.RecordSuccess(account); err != nil {
+		log_utils.Logger.Printf("Error:user ChangePassword lockout RecordSuccess: %v", err)
+	}
+
+	err = user_utils.UpdatePassword(uid, request.NewPassword)
+	if err != nil {
+		if policyViolations(w, err) {
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user ChangePassword: ", err)
+		log_utils.Logger.Printf("Error:user ChangePassword: %v", err)
+		return
+	}
+
+	if err := reset_utils.RevokeAllSessions(uid, sid); err != nil {
+		log.Println("Error:user ChangePassword RevokeAllSessions: ", err)
+		log_utils.Logger.Printf("Error:user ChangePassword RevokeAllSessions: %v", err)
+	}
+
+	audit_utils.Record(r, audit_utils.Event{
+		ActorUid:  uid,
+		Action:    audit_utils.ActionPasswordChange,
+		TargetUid: uid,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	response := map[string]string{"success": "OK!"}
+	json.NewEncoder(w).Encode(response)
+}
+
+// RequestPasswordReset 无论用户名是否存在都返回成功
+func RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	var request model.PasswordResetRequest
+	jsonDecoder(w, r, &request)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := reset_utils.RequestReset(request.Username); err != nil {
+		log.Println("Error:user RequestPasswordReset: ", err)
+		log_utils.Logger.Printf("Error:user RequestPasswordReset: %v", err)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	response := map[string]string{"success": "If the account exists, a reset link has been sent"}
+	json.NewEncoder(w).Encode(response)
+}
+
+func ConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	var request model.PasswordResetConfirm
+	jsonDecoder(w, r, &request)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	uid, err := reset_utils.ConfirmReset(request.Token, request.NewPassword)
+	if err != nil {
+		if policyViolations(w, err) {
+			return
+		}
+		status := http.StatusBadRequest
+		if errors.Is(err, reset_utils.ErrResetTokenInvalid) {
+			status = http.StatusUnauthorized
+		}
+		w.WriteHeader(status)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user ConfirmPasswordReset: ", err)
+		log_utils.Logger.Printf("Error:user ConfirmPasswordReset: %v", err)
+		return
+	}
+
+	audit_utils.Record(r, audit_utils.Event{
+		ActorUid:  uid,
+		Action:    audit_utils.ActionPasswordReset,
+		TargetUid: uid,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	response := map[string]string{"success": "OK!"}
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,132 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/yux77yux/blog-backend/internal/middleware"
+	"github.com/yux77yux/blog-backend/internal/model"
+	"github.com/yux77yux/blog-backend/utils/audit_utils"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+	"github.com/yux77yux/blog-backend/utils/session_utils"
+)
+
+func ListSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	uid, ok := middleware.CallerUid(w, r, "")
+	if !ok {
+		return
+	}
+	sid, _ := middleware.SidFromContext(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+
+	sessions, err := session_utils.ListSessions(uid, sid)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user ListSessions: ", err)
+		log_utils.Logger.Printf("Error:user ListSessions: %v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(sessions)
+}
+
+func RevokeSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	var target model.SessionID
+	jsonDecoder(w, r, &target)
+
+	uid, ok := middleware.CallerUid(w, r, "")
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if target.Sid == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		response := map[string]string{"err": "sid is required"}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	err := session_utils.RevokeSession(uid, target.Sid)
+	if errors.Is(err, session_utils.ErrSessionNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		response := map[string]string{"err": session_utils.ErrSessionNotFound.Error()}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user RevokeSession: ", err)
+		log_utils.Logger.Printf("Error:user RevokeSession: %v", err)
+		return
+	}
+
+	audit_utils.Record(r, audit_utils.Event{
+		ActorUid:  uid,
+		Action:    audit_utils.ActionSessionRevoke,
+		TargetUid: uid,
+		Target:    target.Sid,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	response := map[string]string{"success": "OK!"}
+	json.NewEncoder(w).Encode(response)
+}
+
+func RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	uid, ok := middleware.CallerUid(w, r, "")
+	if !ok {
+		return
+	}
+	sid, _ := middleware.SidFromContext(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := session_utils.RevokeOtherSessions(uid, sid)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user RevokeOtherSessions: ", err)
+		log_utils.Logger.Printf("Error:user RevokeOtherSessions: %v", err)
+		return
+	}
+
+	audit_utils.Record(r, audit_utils.Event{
+		ActorUid:  uid,
+		Action:    audit_utils.ActionSessionRevoke,
+		TargetUid: uid,
+		Target:    "others",
+	})
+
+	w.WriteHeader(http.StatusOK)
+	response := map[string]string{"success": "OK!"}
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,99 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/yux77yux/blog-backend/internal/model"
+	"github.com/yux77yux/blog-backend/utils/ipinfo"
+	"github.com/yux77yux/blog-backend/utils/lockout_utils"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+	"github.com/yux77yux/blog-backend/utils/redis_utils"
+	"github.com/yux77yux/blog-backend/utils/risk_utils"
+	"github.com/yux77yux/blog-backend/utils/user_utils"
+)
+
+// SignInStepUp 异地登录的第二步：用 SignIn 返回的挑战和邮件验证码换取 token
+func SignInStepUp(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	var request model.StepUpChallenge
+	jsonDecoder(w, r, &request)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	ip := ipinfo.GetClientIP(r)
+
+	uid, err := risk_utils.ExchangeStepUp(request.Challenge, request.Code)
+	// 验证码错误与密码错误一样计入该用户名和 IP 的失败次数
+	if errors.Is(err, risk_utils.ErrCodeInvalid) {
+		if retryAfter := recordStepUpFailure(uid, ip); retryAfter > 0 {
+			tooManyAttempts(w, retryAfter)
+			return
+		}
+	}
+	if errors.Is(err, risk_utils.ErrChallengeInvalid) || errors.Is(err, risk_utils.ErrCodeInvalid) {
+		w.WriteHeader(http.StatusUnauthorized)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": "sign in failed"}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user SignInStepUp: ", err)
+		log_utils.Logger.Printf("Error:user SignInStepUp: %v", err)
+		return
+	}
+
+	// 验证码正确，但该用户名或 IP 已被锁定时同样拒绝
+	account := lockout_utils.AccountByUid(uid)
+	retryAfter, err := lockout_utils.Check(account, ip)
+	if err != nil {
+		log_utils.Logger.Printf("Error:user SignInStepUp lockout Check: %v", err)
+	}
+	if retryAfter > 0 {
+		tooManyAttempts(w, retryAfter)
+		return
+	}
+	if err := lockout_utils.RecordSuccess(account); err != nil {
+		log_utils.Logger.Printf("Error:user SignInStepUp lockout RecordSuccess: %v", err)
+	}
+
+	if accountBlocked(w, uid) {
+		return
+	}
+
+	var userInfo *model.UserIncidental
+	userInfo, err = redis_utils.GetUserFromRedis(uid)
+	if err != nil {
+		userInfo, err = user_utils.FetchUser(uid)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			response := map[string]string{"err": "sign in failed"}
+			json.NewEncoder(w).Encode(response)
+			log.Println("Error:user SignInStepUp FetchUser: ", err)
+			log_utils.Logger.Printf("Error:user SignInStepUp FetchUser: %v", err)
+			return
+		}
+	}
+
+	completeSignIn(w, r, userInfo)
+}
+
+// 返回需要等待的时间，未锁定时为 0
+func recordStepUpFailure(uid string, ip string) time.Duration {
+	retryAfter, err := lockout_utils.RecordFailure(lockout_utils.AccountByUid(uid), ip)
+	if err != nil {
+		log_utils.Logger.Printf("Error:user SignInStepUp lockout RecordFailure: %v", err)
+	}
+	return retryAfter
+}
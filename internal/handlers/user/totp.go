@@ -0,0 +1,295 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/yux77yux/blog-backend/internal/middleware"
+	"github.com/yux77yux/blog-backend/internal/model"
+	"github.com/yux77yux/blog-backend/utils/audit_utils"
+	"github.com/yux77yux/blog-backend/utils/ipinfo"
+	"github.com/yux77yux/blog-backend/utils/lockout_utils"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+	"github.com/yux77yux/blog-backend/utils/mfa_utils"
+	"github.com/yux77yux/blog-backend/utils/redis_utils"
+	"github.com/yux77yux/blog-backend/utils/totp_utils"
+	"github.com/yux77yux/blog-backend/utils/user_utils"
+)
+
+// 验证器 App 中显示的发行方
+const totpIssuer = "Blog"
+
+type TotpEnrollResponse struct {
+	Secret string `json:"secret"`
+	// otpauth:// 链接，前端渲染成二维码
+	URI string `json:"uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+func EnrollTotp(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	uid, ok := middleware.CallerUid(w, r, "")
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	secret, err := totp_utils.GenerateSecret()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user EnrollTotp: ", err)
+		log_utils.Logger.Printf("Error:user EnrollTotp: %v", err)
+		return
+	}
+
+	username, err := user_utils.SaveTotpSecret(uid, secret)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user EnrollTotp SaveTotpSecret: ", err)
+		log_utils.Logger.Printf("Error:user EnrollTotp SaveTotpSecret: %v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(TotpEnrollResponse{
+		Secret: secret,
+		URI:    totp_utils.URI(totpIssuer, username, secret),
+	})
+}
+
+func ConfirmTotp(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	var request model.TotpCode
+	jsonDecoder(w, r, &request)
+
+	uid, ok := middleware.CallerUid(w, r, "")
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	secret, enabled, err := user_utils.GetTotp(uid)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user ConfirmTotp: ", err)
+		log_utils.Logger.Printf("Error:user ConfirmTotp: %v", err)
+		return
+	}
+	if secret == "" || enabled {
+		w.WriteHeader(http.StatusConflict)
+		response := map[string]string{"err": "no pending two-factor enrollment"}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	ok, err = mfa_utils.VerifyCode(uid, secret, request.Code)
+	if err != nil {
+		log_utils.Logger.Printf("Error:user ConfirmTotp VerifyCode: %v", err)
+	}
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		response := map[string]string{"err": mfa_utils.ErrCodeInvalid.Error()}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	codes, err := totp_utils.GenerateRecoveryCodes(mfa_utils.RecoveryCodeCount)
+	if err == nil {
+		err = user_utils.EnableTotp(uid, codes)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user ConfirmTotp EnableTotp: ", err)
+		log_utils.Logger.Printf("Error:user ConfirmTotp EnableTotp: %v", err)
+		return
+	}
+
+	// 恢复码只在这里明文返回一次
+	audit_utils.Record(r, audit_utils.Event{
+		ActorUid:  uid,
+		Action:    audit_utils.ActionTotpEnable,
+		TargetUid: uid,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func DisableTotp(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	var request model.TotpCode
+	jsonDecoder(w, r, &request)
+
+	uid, ok := middleware.CallerUid(w, r, "")
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// 验证码错误与密码错误共用锁定计数，避免借已登录的会话穷举验证码和恢复码
+	ip := ipinfo.GetClientIP(r)
+	account := lockout_utils.AccountByUid(uid)
+
+	retryAfter, err := lockout_utils.Check(account, ip)
+	if err != nil {
+		log_utils.Logger.Printf("Error:user DisableTotp lockout Check: %v", err)
+	}
+	if retryAfter > 0 {
+		tooManyAttempts(w, retryAfter)
+		return
+	}
+
+	ok, err = mfa_utils.VerifySecondFactor(uid, request.Code)
+	if err != nil {
+		log_utils.Logger.Printf("Error:user DisableTotp VerifySecondFactor: %v", err)
+	}
+	if !ok {
+		retryAfter, err := lockout_utils.RecordFailure(account, ip)
+		if err != nil {
+			log_utils.Logger.Printf("Error:user DisableTotp lockout RecordFailure: %v", err)
+		}
+		if retryAfter > 0 {
+			tooManyAttempts(w, retryAfter)
+			return
+		}
+
+		w.WriteHeader(http.StatusBadRequest)
+		response := map[string]string{"err": mfa_utils.ErrCodeInvalid.Error()}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	err = user_utils.DisableTotp(uid)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user DisableTotp: ", err)
+		log_utils.Logger.Printf("Error:user DisableTotp: %v", err)
+		return
+	}
+
+	audit_utils.Record(r, audit_utils.Event{
+		ActorUid:  uid,
+		Action:    audit_utils.ActionTotpDisable,
+		TargetUid: uid,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	response := map[string]string{"success": "OK!"}
+	json.NewEncoder(w).Encode(response)
+}
+
+// SignInTotp 两步登录的第二步：用 SignIn 返回的挑战和验证码换取 token
+func SignInTotp(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	var request model.TotpChallenge
+	jsonDecoder(w, r, &request)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	ip := ipinfo.GetClientIP(r)
+
+	uid, err := mfa_utils.ExchangeChallenge(request.Challenge, request.Code)
+	// 验证码错误与密码错误一样计入该账号和 IP 的失败次数
+	if errors.Is(err, mfa_utils.ErrCodeInvalid) {
+		audit_utils.Record(r, audit_utils.Event{
+			Action:    audit_utils.ActionSignInFailed,
+			TargetUid: uid,
+			Target:    "totp",
+		})
+
+		retryAfter, err := lockout_utils.RecordFailure(lockout_utils.AccountByUid(uid), ip)
+		if err != nil {
+			log_utils.Logger.Printf("Error:user SignInTotp lockout RecordFailure: %v", err)
+		}
+		if retryAfter > 0 {
+			tooManyAttempts(w, retryAfter)
+			return
+		}
+	}
+	if errors.Is(err, mfa_utils.ErrChallengeInvalid) || errors.Is(err, mfa_utils.ErrCodeInvalid) {
+		w.WriteHeader(http.StatusUnauthorized)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": "sign in failed"}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user SignInTotp: ", err)
+		log_utils.Logger.Printf("Error:user SignInTotp: %v", err)
+		return
+	}
+
+	// 验证码正确，但该账号或 IP 已被锁定时同样拒绝
+	account := lockout_utils.AccountByUid(uid)
+	retryAfter, err := lockout_utils.Check(account, ip)
+	if err != nil {
+		log_utils.Logger.Printf("Error:user SignInTotp lockout Check: %v", err)
+	}
+	if retryAfter > 0 {
+		tooManyAttempts(w, retryAfter)
+		return
+	}
+	if err := lockout_utils.RecordSuccess(account); err != nil {
+		log_utils.Logger.Printf("Error:user SignInTotp lockout RecordSuccess: %v", err)
+	}
+
+	if accountBlocked(w, uid) {
+		return
+	}
+
+	var userInfo *model.UserIncidental
+	userInfo, err = redis_utils.GetUserFromRedis(uid)
+	if err != nil {
+		userInfo, err = user_utils.FetchUser(uid)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			response := map[string]string{"err": "sign in failed"}
+			json.NewEncoder(w).Encode(response)
+			log.Println("Error:user SignInTotp FetchUser: ", err)
+			log_utils.Logger.Printf("Error:user SignInTotp FetchUser: %v", err)
+			return
+		}
+	}
+
+	completeSignIn(w, r, userInfo)
+}
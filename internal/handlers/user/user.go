@@ -2,18 +2,33 @@ package user
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/yux77yux/blog-backend/internal/middleware"
 	"github.com/yux77yux/blog-backend/internal/model"
 	"github.com/yux77yux/blog-backend/utils/aliyun"
+	"github.com/yux77yux/blog-backend/utils/audit_utils"
+	"github.com/yux77yux/blog-backend/utils/email_utils"
+	"github.com/yux77yux/blog-backend/utils/ipinfo"
 	"github.com/yux77yux/blog-backend/utils/jwt_utils"
+	"github.com/yux77yux/blog-backend/utils/lockout_utils"
 	"github.com/yux77yux/blog-backend/utils/log_utils"
+	"github.com/yux77yux/blog-backend/utils/mfa_utils"
+	"github.com/yux77yux/blog-backend/utils/moderation_utils"
+	"github.com/yux77yux/blog-backend/utils/policy_utils"
+	"github.com/yux77yux/blog-backend/utils/rbac_utils"
 	"github.com/yux77yux/blog-backend/utils/redis_utils"
+	"github.com/yux77yux/blog-backend/utils/risk_utils"
+	"github.com/yux77yux/blog-backend/utils/session_utils"
 	"github.com/yux77yux/blog-backend/utils/user_utils"
 )
 
@@ -37,8 +52,98 @@ func jsonDecoder(w http.ResponseWriter, r *http.Request, target interface{}) {
 }
 
 type UserResponse struct {
-	UserInfo *model.UserIncidental `json:"userInfo"` // 用适当的类型替代 interface{}
-	Token    string                `json:"token"`
+	UserInfo     *model.UserIncidental `json:"userInfo"` // 用适当的类型替代 interface{}
+	Token        string                `json:"token"`
+	RefreshToken string                `json:"refreshToken"`
+}
+
+type TwoFactorResponse struct {
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	Challenge         string `json:"challenge"`
+}
+
+// 异地登录需要邮件验证码时返回
+type StepUpResponse struct {
+	StepUpRequired bool     `json:"stepUpRequired"`
+	Challenge      string   `json:"challenge"`
+	Reasons        []string `json:"reasons"`
+}
+
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+func tooManyAttempts(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	w.WriteHeader(http.StatusTooManyRequests)
+	response := map[string]string{"err": "too many failed attempts, try again later"}
+	json.NewEncoder(w).Encode(response)
+}
+
+type AccountBlockedResponse struct {
+	Err    string `json:"err"`
+	Until  string `json:"until,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// 账号被暂停或封禁时返回 403 并结束请求
+func accountBlocked(w http.ResponseWriter, uid string) bool {
+	status, err := moderation_utils.Check(uid)
+	if errors.Is(err, moderation_utils.ErrAccountSuspended) || errors.Is(err, moderation_utils.ErrAccountBanned) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(AccountBlockedResponse{
+			Err:    err.Error(),
+			Until:  status.Until,
+			Reason: status.Reason,
+		})
+		return true
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": "sign in failed"}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user accountBlocked: ", err)
+		log_utils.Logger.Printf("Error:user accountBlocked: %v", err)
+		return true
+	}
+	return false
+}
+
+type PolicyErrorResponse struct {
+	Err        string                   `json:"err"`
+	Violations []policy_utils.Violation `json:"violations"`
+}
+
+// 用户名或密码不符合策略时返回 400 和逐字段的违规项，其他错误返回 false 交给调用方处理
+func policyViolations(w http.ResponseWriter, err error) bool {
+	var policyErr *policy_utils.PolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusBadRequest)
+	response := PolicyErrorResponse{
+		Err:        "username or password does not meet the policy",
+		Violations: policyErr.Violations,
+	}
+	json.NewEncoder(w).Encode(response)
+	return true
+}
+
+// currentUserInfo 取修改前的资料用于审计，读取失败时返回空值
+func currentUserInfo(uid string) *model.UserIncidental {
+	userInfo, err := redis_utils.GetUserFromRedis(uid)
+	if err == nil {
+		return userInfo
+	}
+	userInfo, err = user_utils.FetchUser(uid)
+	if err != nil {
+		log_utils.Logger.Printf("Error:user currentUserInfo: %v", err)
+		return &model.UserIncidental{}
+	}
+	return userInfo
 }
 
 func SignIn(w http.ResponseWriter, r *http.Request) {
@@ -53,26 +158,247 @@ func SignIn(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 
+	ip := ipinfo.GetClientIP(r)
+
+	// 用户名和邮箱登录同一个账号时共用失败计数
+	account, err := lockout_utils.Account(user.Username)
+	if err != nil {
+		log_utils.Logger.Printf("Error:user SignIn lockout Account: %v", err)
+	}
+
+	retryAfter, err := lockout_utils.Check(account, ip)
+	if err != nil {
+		log_utils.Logger.Printf("Error:user SignIn lockout Check: %v", err)
+	}
+	if retryAfter > 0 {
+		tooManyAttempts(w, retryAfter)
+		return
+	}
+
 	userInfo, err := user_utils.SignIn(user)
+	if errors.Is(err, user_utils.ErrInvalidCredentials) {
+		log_utils.Logger.Printf("Error:user SignIn: %v", err)
+
+		retryAfter, err := lockout_utils.RecordFailure(account, ip)
+		if err != nil {
+			log_utils.Logger.Printf("Error:user SignIn lockout RecordFailure: %v", err)
+		}
+
+		// 用户名不存在时 targetUid 为空，仍按登录名记录
+		targetUid, err := user_utils.FetchUidByLogin(user.Username)
+		if err != nil {
+			log_utils.Logger.Printf("Error:user SignIn FetchUidByLogin: %v", err)
+		}
+		audit_utils.Record(r, audit_utils.Event{
+			Action:    audit_utils.ActionSignInFailed,
+			TargetUid: targetUid,
+			Target:    user.Username,
+		})
+
+		if retryAfter > 0 {
+			tooManyAttempts(w, retryAfter)
+			return
+		}
+
+		w.WriteHeader(http.StatusUnauthorized)
+		response := map[string]string{"err": user_utils.ErrInvalidCredentials.Error()}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		response := map[string]string{"err": err.Error()}
+		response := map[string]string{"err": "sign in failed"}
 		json.NewEncoder(w).Encode(response)
 		log.Println("Error:user SignIn: ", err)
 		log_utils.Logger.Printf("Error:user SignIn: %v", err)
 		return
 	}
 
-	tokenString, err := jwt_utils.GenerateJWT(userInfo.Uid)
+	if accountBlocked(w, userInfo.Uid) {
+		return
+	}
+
+	// 与最近的登录位置比较，定位失败时不拦截登录
+	assessment, err := risk_utils.Assess(userInfo.Uid, ip)
 	if err != nil {
-		log.Println("Error:user : ", err)
+		log_utils.Logger.Printf("Error:user SignIn Assess: %v", err)
+	}
+	flagged := assessment != nil && assessment.Flagged
+	if flagged {
+		location := assessment.Location
+		audit_utils.Record(r, audit_utils.Event{
+			ActorUid:  userInfo.Uid,
+			Action:    audit_utils.ActionSignInSuspicious,
+			TargetUid: userInfo.Uid,
+			Target:    fmt.Sprintf("%s/%s/%s", location.Country, location.Region, location.ASN),
+			After:     strings.Join(assessment.Reasons, ","),
+		})
+	}
+
+	enabled, err := user_utils.IsTotpEnabled(userInfo.Uid)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": "sign in failed"}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user SignIn IsTotpEnabled: ", err)
+		log_utils.Logger.Printf("Error:user SignIn IsTotpEnabled: %v", err)
+		return
 	}
 
+	// 开启了两步验证，先返回挑战，验证码通过后再签发 token
+	if enabled {
+		if flagged {
+			notifySuspiciousSignIn(userInfo.Uid, assessment)
+		}
+
+		challenge, err := mfa_utils.CreateChallenge(userInfo.Uid)
+		if errors.Is(err, mfa_utils.ErrChallengeThrottled) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(mfa_utils.ChallengeThrottle.Seconds())))
+			w.WriteHeader(http.StatusTooManyRequests)
+			response := map[string]string{"err": err.Error()}
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			response := map[string]string{"err": "sign in failed"}
+			json.NewEncoder(w).Encode(response)
+			log.Println("Error:user SignIn CreateChallenge: ", err)
+			log_utils.Logger.Printf("Error:user SignIn CreateChallenge: %v", err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(TwoFactorResponse{
+			TwoFactorRequired: true,
+			Challenge:         challenge,
+		})
+		return
+	}
+
+	if flagged && risk_utils.Default.StepUp {
+		challenge, err := risk_utils.CreateStepUp(userInfo.Uid)
+		if errors.Is(err, risk_utils.ErrStepUpThrottled) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(risk_utils.StepUpThrottle.Seconds())))
+			w.WriteHeader(http.StatusTooManyRequests)
+			response := map[string]string{"err": err.Error()}
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			response := map[string]string{"err": "sign in failed"}
+			json.NewEncoder(w).Encode(response)
+			log.Println("Error:user SignIn CreateStepUp: ", err)
+			log_utils.Logger.Printf("Error:user SignIn CreateStepUp: %v", err)
+			return
+		}
+
+		// 没有已验证的邮箱时无法发送验证码，只留下审计记录
+		if challenge != "" {
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(StepUpResponse{
+				StepUpRequired: true,
+				Challenge:      challenge,
+				Reasons:        assessment.Reasons,
+			})
+			return
+		}
+	}
+
+	if flagged {
+		notifySuspiciousSignIn(userInfo.Uid, assessment)
+	}
+
+	// 需要第二步验证时，等验证通过后才清空失败计数
+	if err := lockout_utils.RecordSuccess(account); err != nil {
+		log_utils.Logger.Printf("Error:user SignIn lockout RecordSuccess: %v", err)
+	}
+
+	completeSignIn(w, r, userInfo)
+}
+
+// 提醒邮件不阻塞登录
+func notifySuspiciousSignIn(uid string, assessment *risk_utils.Assessment) {
+	go func() {
+		if err := risk_utils.Notify(uid, assessment); err != nil {
+			log.Println("Error:user notifySuspiciousSignIn: ", err)
+			log_utils.Logger.Printf("Error:user notifySuspiciousSignIn: %v", err)
+		}
+	}()
+}
+
+// 每次签发都重新读取角色，刷新 token 即可拿到最新的权限
+func generateAccessToken(uid string, sid string) (string, error) {
+	grants, err := rbac_utils.FetchGrants(uid)
+	if err != nil {
+		return "", fmt.Errorf("generateAccessToken: %v", err)
+	}
+	return jwt_utils.GenerateJWT(uid, sid, grants.Roles, grants.Permissions)
+}
+
+// completeSignIn 签发 refresh token、access token 并登记会话
+func completeSignIn(w http.ResponseWriter, r *http.Request, userInfo *model.UserIncidental) {
+	err := redis_utils.SetUserOnline(userInfo.Uid, true)
+	if err != nil {
+		log.Println("Error:user SetUserOnline: ", err)
+		log_utils.Logger.Printf("Error:user SetUserOnline: %v", err)
+	}
+	userInfo.Status = err == nil
+
+	// 没有会话的 access token 在第一次请求时就会被拒绝，任一步失败都不签发
+	refreshToken, sid, err := jwt_utils.GenerateRefreshToken(userInfo.Uid)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": "sign in failed, please try again"}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user GenerateRefreshToken: ", err)
+		log_utils.Logger.Printf("Error:user GenerateRefreshToken: %v", err)
+		return
+	}
+
+	err = session_utils.CreateSession(userInfo.Uid, sid, r)
+	if err != nil {
+		if err := jwt_utils.RevokeRefreshToken(refreshToken); err != nil {
+			log_utils.Logger.Printf("Error:user RevokeRefreshToken: %v", err)
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": "sign in failed, please try again"}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user CreateSession: ", err)
+		log_utils.Logger.Printf("Error:user CreateSession: %v", err)
+		return
+	}
+
+	tokenString, err := generateAccessToken(userInfo.Uid, sid)
+	if err != nil {
+		if err := session_utils.RevokeSession(userInfo.Uid, sid); err != nil {
+			log_utils.Logger.Printf("Error:user RevokeSession: %v", err)
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": "sign in failed, please try again"}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user generateAccessToken: ", err)
+		log_utils.Logger.Printf("Error:user generateAccessToken: %v", err)
+		return
+	}
+
+	// 只有完成全部验证的登录才计入登录位置历史
+	go risk_utils.Remember(userInfo.Uid, ipinfo.GetClientIP(r))
+
 	result := UserResponse{
-		UserInfo: userInfo,
-		Token:    tokenString,
+		UserInfo:     userInfo,
+		Token:        tokenString,
+		RefreshToken: refreshToken,
 	}
 
+	audit_utils.Record(r, audit_utils.Event{
+		ActorUid:  userInfo.Uid,
+		Action:    audit_utils.ActionSignIn,
+		TargetUid: userInfo.Uid,
+		Target:    sid,
+	})
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(result)
 }
@@ -91,8 +417,11 @@ func SignUp(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 
-	err := user_utils.AddUser(user)
+	uid, err := user_utils.AddUser(user)
 	if err != nil {
+		if policyViolations(w, err) {
+			return
+		}
 		w.WriteHeader(http.StatusInternalServerError)
 		response := map[string]string{"err": err.Error()}
 		json.NewEncoder(w).Encode(response)
@@ -100,6 +429,15 @@ func SignUp(w http.ResponseWriter, r *http.Request) {
 		log_utils.Logger.Printf("Error:user AddUser: %v", err)
 		return
 	}
+
+	// 注册时填写了邮箱则发送验证链接，发送失败不影响注册结果
+	if user.Email != "" {
+		email, _ := user_utils.ValidateEmail(user.Email)
+		if err := email_utils.SendVerification(uid, email); err != nil {
+			log.Println("Error:user SendVerification: ", err)
+			log_utils.Logger.Printf("Error:user SendVerification: %v", err)
+		}
+	}
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -128,6 +466,55 @@ func ToBlack(tokenString string) error {
 	return nil
 }
 
+func Refresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	var request model.RefreshToken
+	jsonDecoder(w, r, &request)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	uid, sid, refreshToken, err := jwt_utils.RotateRefreshToken(request.RefreshToken)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, jwt_utils.ErrRefreshTokenInvalid) || errors.Is(err, jwt_utils.ErrRefreshTokenReused) {
+			status = http.StatusUnauthorized
+		}
+		w.WriteHeader(status)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user Refresh: ", err)
+		log_utils.Logger.Printf("Error:user Refresh: %v", err)
+		return
+	}
+
+	tokenString, err := generateAccessToken(uid, sid)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:user Refresh GenerateJWT: ", err)
+		log_utils.Logger.Printf("Error:user Refresh GenerateJWT: %v", err)
+		return
+	}
+
+	if err := session_utils.TouchSession(sid, ""); err != nil {
+		log_utils.Logger.Printf("Error:user Refresh TouchSession: %v", err)
+	}
+
+	result := TokenResponse{
+		Token:        tokenString,
+		RefreshToken: refreshToken,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
+
 func SignOut(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
@@ -135,8 +522,11 @@ func SignOut(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	uid := r.FormValue("uid")
-	tokenString := r.Header.Get("Authorization")
+	uid, ok := middleware.CallerUid(w, r, r.FormValue("uid"))
+	if !ok {
+		return
+	}
+	tokenString := middleware.BearerToken(r)
 
 	w.Header().Set("Content-Type", "application/json")
 
@@ -160,6 +550,26 @@ func SignOut(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if sid, ok := middleware.SidFromContext(r.Context()); ok {
+		if err := session_utils.RevokeSession(uid, sid); err != nil {
+			log.Println("Error:user SignOut RevokeSession: ", err)
+			log_utils.Logger.Printf("Error:user SignOut RevokeSession: %v", err)
+		}
+	}
+
+	if refreshToken := r.FormValue("refreshToken"); refreshToken != "" {
+		if err := jwt_utils.RevokeRefreshToken(refreshToken); err != nil {
+			log.Println("Error:user SignOut RevokeRefreshToken: ", err)
+			log_utils.Logger.Printf("Error:user SignOut RevokeRefreshToken: %v", err)
+		}
+	}
+
+	audit_utils.Record(r, audit_utils.Event{
+		ActorUid:  uid,
+		Action:    audit_utils.ActionSignOut,
+		TargetUid: uid,
+	})
+
 	w.WriteHeader(http.StatusOK)
 	response := map[string]string{"success": "Sign out successful"}
 	json.NewEncoder(w).Encode(response)
@@ -183,8 +593,20 @@ func FetchUser(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 
+	// 被隐藏内容的用户对外表现为不存在
+	hidden, err := redis_utils.IsContentHidden(uid)
+	if err != nil {
+		log_utils.Logger.Printf("Error:user FetchUser IsContentHidden: %v", err)
+	}
+	if hidden {
+		w.WriteHeader(http.StatusNotFound)
+		response := map[string]string{"err": "user not found"}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
 	var currentUser *model.UserIncidental
-	currentUser, err := redis_utils.GetUserFromRedis(uid)
+	currentUser, err = redis_utils.GetUserFromRedis(uid)
 
 	if err != nil {
 		currentUser, err = user_utils.FetchUser(uid)
@@ -217,7 +639,12 @@ func UpdateProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	uid := r.FormValue("uid")
+	uid, ok := middleware.CallerUid(w, r, r.FormValue("uid"))
+	if !ok {
+		return
+	}
+
+	before := currentUserInfo(uid)
 
 	var file_name string
 	var profile_path string
@@ -234,7 +661,8 @@ func UpdateProfile(w http.ResponseWriter, r *http.Request) {
 	} else {
 		defer file.Close()
 
-		file_name = "images/profiles/" + fileHeader.Filename
+		// 按 uid 分目录，删除账号时才能确定哪些文件属于该用户
+		file_name = "images/profiles/" + uid + "/" + fileHeader.Filename
 		profile_path, err = aliyun.UploadFile(file, file_name)
 		if err != nil {
 			log.Println("Error:user UploadFile: uploading file:", err)
@@ -246,6 +674,11 @@ func UpdateProfile(w http.ResponseWriter, r *http.Request) {
 			json.NewEncoder(w).Encode(response)
 			return
 		}
+
+		if err := user_utils.AddMedia(uid, file_name, "profile"); err != nil {
+			log.Println("Error:user AddMedia: ", err)
+			log_utils.Logger.Printf("Error:user AddMedia: %v", err)
+		}
 	}
 
 	modify_info := model.UserModifyProfile{
@@ -271,6 +704,14 @@ func UpdateProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	audit_utils.Record(r, audit_utils.Event{
+		ActorUid:  uid,
+		Action:    audit_utils.ActionProfileChange,
+		TargetUid: uid,
+		Before:    before.Profile,
+		After:     modify_info.Profile,
+	})
+
 	w.WriteHeader(http.StatusOK)
 	response := map[string]string{"success": "OK!"}
 	json.NewEncoder(w).Encode(response)
@@ -288,6 +729,13 @@ func UpdateName(w http.ResponseWriter, r *http.Request) {
 
 	jsonDecoder(w, r, &modify_info)
 
+	uid, ok := middleware.CallerUid(w, r, modify_info.Uid)
+	if !ok {
+		return
+	}
+	modify_info.Uid = uid
+	before := currentUserInfo(uid)
+
 	go (func() {
 		err := user_utils.UpdateName(&modify_info)
 		if err != nil {
@@ -306,6 +754,14 @@ func UpdateName(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	audit_utils.Record(r, audit_utils.Event{
+		ActorUid:  uid,
+		Action:    audit_utils.ActionNameChange,
+		TargetUid: uid,
+		Before:    before.Name,
+		After:     modify_info.Name,
+	})
+
 	w.WriteHeader(http.StatusOK)
 	response := map[string]string{"success": "OK!"}
 	json.NewEncoder(w).Encode(response)
@@ -322,6 +778,13 @@ func UpdateBio(w http.ResponseWriter, r *http.Request) {
 
 	jsonDecoder(w, r, &modify_info)
 
+	uid, ok := middleware.CallerUid(w, r, modify_info.Uid)
+	if !ok {
+		return
+	}
+	modify_info.Uid = uid
+	before := currentUserInfo(uid)
+
 	go (func() {
 		err := user_utils.UpdateBio(&modify_info)
 		if err != nil {
@@ -340,6 +803,14 @@ func UpdateBio(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	audit_utils.Record(r, audit_utils.Event{
+		ActorUid:  uid,
+		Action:    audit_utils.ActionBioChange,
+		TargetUid: uid,
+		Before:    before.Bio,
+		After:     modify_info.Bio,
+	})
+
 	w.WriteHeader(http.StatusOK)
 	response := map[string]string{"success": "OK!"}
 	json.NewEncoder(w).Encode(response)
@@ -354,7 +825,7 @@ func AutoSignIn(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 
-	tokenString := r.Header.Get("Authorization")
+	tokenString := middleware.BearerToken(r)
 	if tokenString == "" {
 		w.WriteHeader(http.StatusInternalServerError)
 		response := map[string]string{"err": "Authorization header is missing"}
@@ -365,8 +836,9 @@ func AutoSignIn(w http.ResponseWriter, r *http.Request) {
 
 	token, err := jwt_utils.ParseJWT(tokenString)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		response := map[string]string{"err": err.Error()}
+		status, msg := middleware.TokenError(err)
+		w.WriteHeader(status)
+		response := map[string]string{"err": msg}
 		json.NewEncoder(w).Encode(response)
 		log.Println("Error: ParseJWT: ", err)
 		return
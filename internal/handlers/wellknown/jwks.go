@@ -0,0 +1,36 @@
+package wellknown
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/yux77yux/blog-backend/utils/jwt_utils"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+)
+
+// JWKS 公开验签公钥，其他服务可以离线校验本服务签发的 token
+func JWKS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	set, err := jwt_utils.PublicJWKS()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response := map[string]string{"err": err.Error()}
+		json.NewEncoder(w).Encode(response)
+		log.Println("Error:wellknown JWKS: ", err)
+		log_utils.Logger.Printf("Error:wellknown JWKS: %v", err)
+		return
+	}
+
+	// 密钥轮换存在重叠窗口，短时间缓存即可
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(set)
+}
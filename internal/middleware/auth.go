@@ -0,0 +1,226 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/yux77yux/blog-backend/utils/jwt_utils"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+	"github.com/yux77yux/blog-backend/utils/pat_utils"
+	"github.com/yux77yux/blog-backend/utils/rbac_utils"
+	"github.com/yux77yux/blog-backend/utils/session_utils"
+)
+
+type contextKey string
+
+const (
+	uidKey   contextKey = "uid"
+	sidKey   contextKey = "sid"
+	tokenKey contextKey = "token"
+	rolesKey contextKey = "roles"
+	permsKey contextKey = "perms"
+	// 使用个人访问令牌认证时为令牌 ID
+	accessTokenKey contextKey = "accessToken"
+)
+
+// BearerToken 从 Authorization 头取出 token，兼容不带 Bearer 前缀的旧客户端
+func BearerToken(r *http.Request) string {
+	header := strings.TrimSpace(r.Header.Get("Authorization"))
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return header
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	response := map[string]string{"err": msg}
+	json.NewEncoder(w).Encode(response)
+}
+
+// TokenError 把 ParseJWT 的错误映射为状态码和返回给客户端的信息
+func TokenError(err error) (int, string) {
+	switch {
+	case errors.Is(err, jwt_utils.ErrTokenMalformed):
+		return http.StatusBadRequest, jwt_utils.ErrTokenMalformed.Error()
+	case errors.Is(err, jwt_utils.ErrTokenExpired):
+		return http.StatusUnauthorized, jwt_utils.ErrTokenExpired.Error()
+	case errors.Is(err, jwt_utils.ErrTokenRevoked):
+		return http.StatusUnauthorized, jwt_utils.ErrTokenRevoked.Error()
+	case errors.Is(err, jwt_utils.ErrTokenSignature):
+		return http.StatusUnauthorized, jwt_utils.ErrTokenSignature.Error()
+	case errors.Is(err, jwt_utils.ErrAccountDisabled):
+		return http.StatusForbidden, jwt_utils.ErrAccountDisabled.Error()
+	case errors.Is(err, pat_utils.ErrTokenInvalid):
+		return http.StatusUnauthorized, pat_utils.ErrTokenInvalid.Error()
+	}
+	return http.StatusInternalServerError, "failed to verify token"
+}
+
+// Authenticate 校验 JWT 或个人访问令牌，并把当前用户 uid 和权限放入请求上下文
+func Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenString := BearerToken(r)
+		if tokenString == "" {
+			writeError(w, http.StatusUnauthorized, "Authorization header is missing")
+			return
+		}
+
+		if pat_utils.IsAccessToken(tokenString) {
+			uid, tokenId, permissions, err := pat_utils.Authenticate(tokenString)
+			if err != nil {
+				status, msg := TokenError(err)
+				writeError(w, status, msg)
+				log_utils.Logger.Printf("Error: middleware Authenticate access token: %v", err)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), uidKey, uid)
+			ctx = context.WithValue(ctx, permsKey, permissions)
+			ctx = context.WithValue(ctx, accessTokenKey, tokenId)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		token, err := jwt_utils.ParseJWT(tokenString)
+		if err != nil {
+			status, msg := TokenError(err)
+			writeError(w, status, msg)
+			log_utils.Logger.Printf("Error: middleware Authenticate ParseJWT: %v", err)
+			return
+		}
+
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "invalid claims")
+			return
+		}
+
+		uid, ok := claims["sub"].(string)
+		if !ok || uid == "" {
+			writeError(w, http.StatusUnauthorized, "sub claim is missing or not a string")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), uidKey, uid)
+		ctx = context.WithValue(ctx, tokenKey, token)
+		ctx = context.WithValue(ctx, rolesKey, claimStrings(claims, "roles"))
+		ctx = context.WithValue(ctx, permsKey, claimStrings(claims, "perms"))
+
+		if sid, ok := claims["sid"].(string); ok && sid != "" {
+			ctx = context.WithValue(ctx, sidKey, sid)
+
+			jti, _ := claims["jti"].(string)
+			if err := session_utils.TouchSession(sid, jti); err != nil {
+				log_utils.Logger.Printf("Error: middleware Authenticate TouchSession: %v", err)
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// UidFromContext 返回 Authenticate 写入的已认证 uid
+func UidFromContext(ctx context.Context) (string, bool) {
+	uid, ok := ctx.Value(uidKey).(string)
+	return uid, ok && uid != ""
+}
+
+// SidFromContext 返回当前请求所属的会话 ID
+func SidFromContext(ctx context.Context) (string, bool) {
+	sid, ok := ctx.Value(sidKey).(string)
+	return sid, ok && sid != ""
+}
+
+// TokenFromContext 返回 Authenticate 解析过的 token
+func TokenFromContext(ctx context.Context) (*jwt.Token, bool) {
+	token, ok := ctx.Value(tokenKey).(*jwt.Token)
+	return token, ok
+}
+
+// CallerUid 取出当前用户 uid；客户端另外传了 uid 且不一致时返回 403
+func CallerUid(w http.ResponseWriter, r *http.Request, claimed string) (string, bool) {
+	uid, ok := UidFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthenticated")
+		return "", false
+	}
+
+	if claimed != "" && claimed != uid {
+		writeError(w, http.StatusForbidden, "uid does not match the authenticated user")
+		log_utils.Logger.Printf("Error: middleware CallerUid: %s tried to act as %s", uid, claimed)
+		return "", false
+	}
+
+	return uid, true
+}
+
+// 从 claims 中取出字符串数组，JSON 解码后是 []interface{}
+func claimStrings(claims jwt.MapClaims, name string) []string {
+	values, _ := claims[name].([]interface{})
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// PermissionsFromContext 返回 access token 或个人访问令牌携带的权限
+func PermissionsFromContext(ctx context.Context) []string {
+	permissions, _ := ctx.Value(permsKey).([]string)
+	return permissions
+}
+
+// RolesFromContext 返回 access token 中携带的角色，个人访问令牌没有角色
+func RolesFromContext(ctx context.Context) []string {
+	roles, _ := ctx.Value(rolesKey).([]string)
+	return roles
+}
+
+// AccessTokenFromContext 返回认证所用的个人访问令牌 ID
+func AccessTokenFromContext(ctx context.Context) (string, bool) {
+	tokenId, ok := ctx.Value(accessTokenKey).(string)
+	return tokenId, ok && tokenId != ""
+}
+
+// HasPermission 用于处理函数内部的判断，例如修改他人文章
+func HasPermission(ctx context.Context, permission string) bool {
+	return rbac_utils.HasPermission(PermissionsFromContext(ctx), permission)
+}
+
+// RequirePermission 需要在 Authenticate 之后使用
+func RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			uid, ok := UidFromContext(r.Context())
+			if !ok {
+				writeError(w, http.StatusUnauthorized, "unauthenticated")
+				return
+			}
+			if !HasPermission(r.Context(), permission) {
+				writeError(w, http.StatusForbidden, "permission denied")
+				log_utils.Logger.Printf("Error: middleware RequirePermission: %s lacks %s", uid, permission)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSession 拒绝个人访问令牌，账号与安全设置只能在登录会话中修改
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := AccessTokenFromContext(r.Context()); ok {
+			writeError(w, http.StatusForbidden, "access tokens cannot be used for this endpoint")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
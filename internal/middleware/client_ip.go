@@ -0,0 +1,14 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/yux77yux/blog-backend/utils/ipinfo"
+)
+
+// ClientIP 在最外层解析客户端 IP，之后的处理都从上下文读取同一个结果
+func ClientIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, ipinfo.WithClientIP(r))
+	})
+}
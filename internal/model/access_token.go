@@ -0,0 +1,28 @@
+package model
+
+type AccessToken struct {
+	TokenId string `json:"tokenId"`
+	Name    string `json:"name"`
+	//令牌可以使用的权限，实际生效的是它与用户当前权限的交集
+	Scopes     []string `json:"scopes"`
+	CreatedAt  string   `json:"createdAt"`
+	ExpiresAt  string   `json:"expiresAt"`
+	LastUsedAt string   `json:"lastUsedAt"`
+}
+
+type NewAccessToken struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	//有效天数，0 表示使用默认值
+	ExpiresInDays int `json:"expiresInDays"`
+}
+
+// 创建令牌的响应，明文 token 只返回这一次
+type CreatedAccessToken struct {
+	*AccessToken
+	Token string `json:"token"`
+}
+
+type AccessTokenID struct {
+	TokenId string `json:"tokenId"`
+}
@@ -0,0 +1,22 @@
+package model
+
+type AccountInfo struct {
+	Uid          string `json:"uid"`
+	Username     string `json:"username"`
+	Email        string `json:"email"`
+	PendingEmail string `json:"pendingEmail"`
+	//计划删除的时间，为空表示未申请删除
+	DeleteAfter string `json:"deleteAfter"`
+}
+
+// Media 是用户上传到 OSS 的对象
+type Media struct {
+	ObjectName string `json:"objectName"`
+	//profile 等上传用途
+	Kind      string `json:"kind"`
+	CreatedAt string `json:"createdAt"`
+}
+
+type DeleteAccount struct {
+	Password string `json:"password"`
+}
@@ -0,0 +1,130 @@
+package model
+
+type Article struct {
+	//主键，唯一搜索
+	Uuid string `json:"uuid"`
+	//作者 uid
+	Uid   string `json:"uid"`
+	Title string `json:"title"`
+	//标题是否高亮
+	TitleLight string `json:"titleLight"`
+	//封面大小，用于类选择器
+	CoverDimensions string `json:"coverDimensions"`
+	CoverImageUrl   string `json:"coverImageUrl"`
+	Summary         string `json:"summary"`
+	Content         string `json:"content"`
+	CreatedAt       string `json:"createdAt"`
+	UpdatedAt       string `json:"updatedAt"`
+	//发布时的时区
+	Timezone string `json:"timezone"`
+	Views    int    `json:"views"`
+	Likes    int    `json:"likes"`
+	Tags     string `json:"tags"`
+	//0草稿，1发布
+	Status     int     `json:"status"`
+	Popularity float32 `json:"popularity"`
+	//首次发布时间，草稿为空
+	PublishedAt string `json:"publishedAt"`
+	//定时发布时间，没有安排时为空
+	ScheduledAt string `json:"scheduledAt"`
+	//由 content 渲染并过滤后的 HTML，只在读取单篇文章时返回
+	ContentHtml string     `json:"contentHtml,omitempty"`
+	Toc         []TocEntry `json:"toc,omitempty"`
+}
+
+// 目录项，Id 与 ContentHtml 中标题的 id 属性对应
+type TocEntry struct {
+	Level int    `json:"level"`
+	Id    string `json:"id"`
+	Text  string `json:"text"`
+}
+
+// 创建或修改文章时客户端可以填写的字段，作者、时间和 uuid 由服务端生成
+type ArticleEdit struct {
+	//修改时必填
+	Uuid            string `json:"uuid"`
+	Title           string `json:"title"`
+	TitleLight      string `json:"titleLight"`
+	CoverDimensions string `json:"coverDimensions"`
+	CoverImageUrl   string `json:"coverImageUrl"`
+	Summary         string `json:"summary"`
+	Content         string `json:"content"`
+	Tags            string `json:"tags"`
+}
+
+type ArticleID struct {
+	Uuid string `json:"uuid"`
+}
+
+// 定时发布，PublishAt 为 RFC3339 格式
+type ArticleSchedule struct {
+	Uuid      string `json:"uuid"`
+	PublishAt string `json:"publishAt"`
+}
+
+type ArticlePage struct {
+	Articles []*Article `json:"articles"`
+	Page     int        `json:"page"`
+	PageSize int        `json:"pageSize"`
+	Total    int        `json:"total"`
+}
+
+// 每次保存生成的不可修改的版本
+type ArticleRevision struct {
+	Uuid     string `json:"uuid"`
+	Revision int    `json:"revision"`
+	//保存者的 uid
+	Editor    string `json:"editor"`
+	Title     string `json:"title"`
+	Summary   string `json:"summary"`
+	Content   string `json:"content"`
+	Tags      string `json:"tags"`
+	CreatedAt string `json:"createdAt"`
+	//由哪个版本恢复而来，普通保存为 0
+	RestoredFrom int `json:"restoredFrom"`
+}
+
+type ArticleRevisionPage struct {
+	Revisions []*ArticleRevision `json:"revisions"`
+	Page      int                `json:"page"`
+	PageSize  int                `json:"pageSize"`
+	Total     int                `json:"total"`
+}
+
+type ArticleRestore struct {
+	Uuid     string `json:"uuid"`
+	Revision int    `json:"revision"`
+}
+
+// Op 为 equal、insert 或 delete
+type DiffChunk struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+type ArticleDiff struct {
+	Uuid string `json:"uuid"`
+	From int    `json:"from"`
+	To   int    `json:"to"`
+	//line 或 word
+	Mode    string      `json:"mode"`
+	Title   []DiffChunk `json:"title"`
+	Summary []DiffChunk `json:"summary"`
+	Tags    []DiffChunk `json:"tags"`
+	Content []DiffChunk `json:"content"`
+}
+
+type Tag struct {
+	//规范化后的标签，用于链接与查询
+	Slug string `json:"slug"`
+	//首次出现时的写法
+	Name string `json:"name"`
+	//已发布的文章数
+	Count int `json:"count"`
+}
+
+// 标签页：标签信息与该标签下的文章
+type TagPage struct {
+	Tag *Tag `json:"tag"`
+	ArticlePage
+}
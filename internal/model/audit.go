@@ -0,0 +1,24 @@
+package model
+
+type AuditEvent struct {
+	EventId int64 `json:"eventId"`
+	//执行操作的用户，登录失败等匿名操作为空
+	ActorUid string `json:"actorUid"`
+	Action   string `json:"action"`
+	//被操作的用户
+	TargetUid string `json:"targetUid"`
+	//其他操作对象，如用户名、会话 ID、角色名
+	Target    string `json:"target"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"userAgent"`
+	Before    string `json:"before"`
+	After     string `json:"after"`
+	CreatedAt string `json:"createdAt"`
+}
+
+type AuditPage struct {
+	Events   []*AuditEvent `json:"events"`
+	Page     int           `json:"page"`
+	PageSize int           `json:"pageSize"`
+	Total    int           `json:"total"`
+}
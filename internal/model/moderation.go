@@ -0,0 +1,20 @@
+package model
+
+type AccountStatus struct {
+	Uid string `json:"uid"`
+	//active、suspended 或 banned
+	State string `json:"state"`
+	//暂停到期时间，只在 suspended 时有值
+	Until  string `json:"until"`
+	Reason string `json:"reason"`
+	//是否对外隐藏资料和文章
+	ContentHidden bool `json:"contentHidden"`
+}
+
+type ModerationTarget struct {
+	Uid string `json:"uid"`
+	//暂停时长（小时），仅用于暂停
+	Hours       int    `json:"hours"`
+	Reason      string `json:"reason"`
+	HideContent bool   `json:"hideContent"`
+}
@@ -0,0 +1,16 @@
+package model
+
+type Passkey struct {
+	//base64url 编码的凭证 ID
+	CredentialId string `json:"credentialId"`
+	Name         string `json:"name"`
+	SignCount    uint32 `json:"signCount"`
+	CreatedAt    string `json:"createdAt"`
+	LastUsedAt   string `json:"lastUsedAt"`
+	//凭证 JSON，只在服务端使用
+	Credential string `json:"-"`
+}
+
+type PasskeyID struct {
+	CredentialId string `json:"credentialId"`
+}
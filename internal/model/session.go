@@ -0,0 +1,20 @@
+package model
+
+type Session struct {
+	//会话 ID，与 refresh token 家族一致
+	Sid string `json:"sid"`
+	//最近一次使用的 access token
+	Jti       string `json:"jti"`
+	CreatedAt int64  `json:"createdAt"`
+	LastSeen  int64  `json:"lastSeen"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"userAgent"`
+	City      string `json:"city"`
+	Country   string `json:"country"`
+	//是否为发起请求的会话
+	Current bool `json:"current"`
+}
+
+type SessionID struct {
+	Sid string `json:"sid"`
+}
@@ -0,0 +1,21 @@
+package model
+
+type SignInLocation struct {
+	IP      string `json:"ip"`
+	Country string `json:"country"`
+	Region  string `json:"region"`
+	City    string `json:"city"`
+	//自治系统编号，如 AS15169
+	ASN string `json:"asn"`
+	//没有坐标时为 nil
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	CreatedAt string   `json:"createdAt"`
+	//距离查询时刻的秒数，由数据库计算，避免应用与数据库时区不一致
+	SecondsAgo int64 `json:"secondsAgo"`
+}
+
+type StepUpChallenge struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
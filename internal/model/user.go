@@ -1,8 +1,11 @@
 package model
 
 type UsernameAndPassword struct {
+	//登录时也可以填写已验证的邮箱
 	Username string
 	Password string
+	//注册时可选，验证通过后才能用于登录和找回密码
+	Email string
 }
 
 type UserIncidental struct {
@@ -34,3 +37,39 @@ type UserModifyBio struct {
 	Uid string `json:"uid"`
 	Bio string `json:"bio"`
 }
+
+type RefreshToken struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type TotpCode struct {
+	Code string `json:"code"`
+}
+
+type TotpChallenge struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+type ChangePassword struct {
+	OldPassword string `json:"oldPassword"`
+	NewPassword string `json:"newPassword"`
+}
+
+type PasswordResetRequest struct {
+	Username string `json:"username"`
+}
+
+type PasswordResetConfirm struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"newPassword"`
+}
+
+type ChangeEmail struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type EmailVerification struct {
+	Token string `json:"token"`
+}
@@ -0,0 +1,183 @@
+package account_utils
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yux77yux/blog-backend/utils/aliyun"
+	"github.com/yux77yux/blog-backend/utils/jwt_utils"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+	"github.com/yux77yux/blog-backend/utils/mail_utils"
+	"github.com/yux77yux/blog-backend/utils/redis_utils"
+	"github.com/yux77yux/blog-backend/utils/session_utils"
+	"github.com/yux77yux/blog-backend/utils/user_utils"
+)
+
+const (
+	// 申请删除后保留数据的天数，期间登录可以撤销
+	GracePeriodDays = 14
+	// 清除任务的执行间隔
+	purgeInterval = time.Hour
+)
+
+// RequestDeletion 安排删除账号并让所有已登录的设备下线，返回计划删除的时间；
+// 宽限期内个人访问令牌由 pat_utils.Authenticate 拒绝，撤销申请后恢复
+func RequestDeletion(uid string) (string, error) {
+	deleteAfter, err := user_utils.ScheduleDeletion(uid, GracePeriodDays)
+	if err != nil {
+		return "", fmt.Errorf("account_utils RequestDeletion: %v", err)
+	}
+
+	if err := session_utils.RevokeOtherSessions(uid, ""); err != nil {
+		log_utils.Logger.Printf("Error: account_utils RequestDeletion: %v", err)
+	}
+	if err := jwt_utils.RevokeTokensIssuedBefore(uid, time.Now()); err != nil {
+		log_utils.Logger.Printf("Error: account_utils RequestDeletion: %v", err)
+	}
+
+	email, _, err := user_utils.FetchEmail(uid)
+	if err != nil {
+		log_utils.Logger.Printf("Error: account_utils RequestDeletion: %v", err)
+	}
+	if email != "" {
+		err := mail_utils.Send(mail_utils.Message{
+			To:      email,
+			Subject: "账号删除申请",
+			Body: fmt.Sprintf("你好：\n\n你的账号将在 %s 之后被永久删除。\n在此之前重新登录并撤销申请即可保留账号。\n\n如果不是你本人操作，请尽快登录并修改密码。\n",
+				deleteAfter),
+		})
+		if err != nil {
+			log_utils.Logger.Printf("Error: account_utils RequestDeletion: %v", err)
+		}
+	}
+
+	return deleteAfter, nil
+}
+
+func CancelDeletion(uid string) (bool, error) {
+	cancelled, err := user_utils.CancelDeletion(uid)
+	if err != nil {
+		return false, fmt.Errorf("account_utils CancelDeletion: %v", err)
+	}
+	return cancelled, nil
+}
+
+// 只删除确定属于该用户的对象：登记过的上传、放在 uid 目录下的头像，以及只被该用户文章使用的封面
+func ownedObjects(uid string) ([]string, error) {
+	media, err := user_utils.FetchMedia(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	seen := map[string]bool{}
+	for _, item := range media {
+		if !seen[item.ObjectName] {
+			seen[item.ObjectName] = true
+			names = append(names, item.ObjectName)
+		}
+	}
+
+	profile, err := user_utils.FetchUser(uid)
+	if profile != nil {
+		name := aliyun.ObjectNameFromURL(profile.Profile)
+		if strings.HasPrefix(name, fmt.Sprintf("images/profiles/%s/", uid)) && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	covers, err := user_utils.FetchCoverUrls(uid)
+	if err != nil {
+		return nil, err
+	}
+	for _, cover := range covers {
+		name := aliyun.BucketObjectName(cover)
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
+
+// Purge 立即清除用户的对象存储文件、数据库记录和 Redis 数据
+func Purge(uid string) error {
+	names, err := ownedObjects(uid)
+	if err != nil {
+		return fmt.Errorf("account_utils Purge: %v", err)
+	}
+
+	// 先删文件，失败时保留数据库记录，下次任务重试
+	if len(names) > 0 {
+		if err := aliyun.DeleteObjects(names); err != nil {
+			return fmt.Errorf("account_utils Purge DeleteObjects: %v", err)
+		}
+	}
+
+	if err := session_utils.RevokeOtherSessions(uid, ""); err != nil {
+		log_utils.Logger.Printf("Error: account_utils Purge: %v", err)
+	}
+
+	if err := user_utils.PurgeUser(uid); err != nil {
+		return fmt.Errorf("account_utils Purge: %v", err)
+	}
+
+	if err := redis_utils.DeleteUserFromRedis(uid); err != nil {
+		log_utils.Logger.Printf("Error: account_utils Purge: %v", err)
+	}
+	if err := redis_utils.SetUserOnline(uid, false); err != nil {
+		log_utils.Logger.Printf("Error: account_utils Purge SetUserOnline: %v", err)
+	}
+	if err := redis_utils.SetContentHidden(uid, false, 0); err != nil {
+		log_utils.Logger.Printf("Error: account_utils Purge: %v", err)
+	}
+	if err := redis_utils.ClearAccountBlocked(uid); err != nil {
+		log_utils.Logger.Printf("Error: account_utils Purge: %v", err)
+	}
+
+	log_utils.Logger.Printf("account_utils Purge: purged %s, %d objects", uid, len(names))
+	return nil
+}
+
+func purgeDue() error {
+	// 多个实例只需要一个执行
+	ok, err := redis_utils.AcquireThrottle("account_purge", purgeInterval-time.Minute)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+
+	uids, err := user_utils.FetchDueDeletions()
+	if err != nil {
+		return err
+	}
+
+	for _, uid := range uids {
+		if err := Purge(uid); err != nil {
+			log_utils.Logger.Printf("Error: account_utils purgeDue %s: %v", uid, err)
+		}
+	}
+	return nil
+}
+
+func SchedulePurge() {
+	if err := purgeDue(); err != nil {
+		log_utils.Logger.Printf("Error: account_utils purging deleted accounts: %v", err)
+	}
+
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := purgeDue(); err != nil {
+			log_utils.Logger.Printf("Error: account_utils purging deleted accounts: %v", err)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package account_utils
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/yux77yux/blog-backend/internal/model"
+	"github.com/yux77yux/blog-backend/utils/aliyun"
+	"github.com/yux77yux/blog-backend/utils/rbac_utils"
+	"github.com/yux77yux/blog-backend/utils/user_utils"
+)
+
+type exportData struct {
+	Account  *model.AccountInfo
+	Roles    []string
+	Profile  *model.UserIncidental
+	Articles []*model.Article
+	Media    []*model.Media
+}
+
+func collect(uid string) (*exportData, error) {
+	account, err := user_utils.FetchAccount(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	grants, err := rbac_utils.FetchGrants(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := user_utils.FetchUser(uid)
+	if err != nil && profile == nil {
+		return nil, err
+	}
+
+	articles, err := user_utils.FetchArticlesByUid(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	media, err := user_utils.FetchMedia(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	return &exportData{
+		Account:  account,
+		Roles:    grants.Roles,
+		Profile:  profile,
+		Articles: articles,
+		Media:    withReferencedMedia(media, profile, articles),
+	}, nil
+}
+
+// 补上头像、封面中引用但没有登记过的对象（登记表建立之前上传的文件）
+func withReferencedMedia(media []*model.Media, profile *model.UserIncidental, articles []*model.Article) []*model.Media {
+	seen := map[string]bool{}
+	for _, item := range media {
+		seen[item.ObjectName] = true
+	}
+
+	add := func(rawURL string, kind string) {
+		name := aliyun.ObjectNameFromURL(rawURL)
+		if name == "" || seen[name] {
+			return
+		}
+		seen[name] = true
+		media = append(media, &model.Media{ObjectName: name, Kind: kind})
+	}
+
+	add(profile.Profile, "profile")
+	for _, article := range articles {
+		add(article.CoverImageUrl, "cover")
+	}
+	return media
+}
+
+func writeJSON(archive *zip.Writer, name string, value interface{}) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+func writeText(archive *zip.Writer, name string, text string) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(file, text)
+	return err
+}
+
+func articleMarkdown(article *model.Article) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", article.Title)
+	fmt.Fprintf(&b, "- uuid: %s\n", article.Uuid)
+	fmt.Fprintf(&b, "- createdAt: %s (%s)\n", article.CreatedAt, article.Timezone)
+	fmt.Fprintf(&b, "- updatedAt: %s\n", article.UpdatedAt)
+	if article.Tags != "" {
+		fmt.Fprintf(&b, "- tags: %s\n", article.Tags)
+	}
+	if article.Summary != "" {
+		fmt.Fprintf(&b, "\n> %s\n", strings.ReplaceAll(article.Summary, "\n", "\n> "))
+	}
+	fmt.Fprintf(&b, "\n%s\n", article.Content)
+	return b.String()
+}
+
+func readme(data *exportData) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# 数据导出\n\n")
+	fmt.Fprintf(&b, "- 导出时间：%s\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(&b, "- uid：%s\n", data.Account.Uid)
+	fmt.Fprintf(&b, "- 用户名：%s\n", data.Account.Username)
+	if data.Profile != nil {
+		fmt.Fprintf(&b, "- 昵称：%s\n", data.Profile.Name)
+		fmt.Fprintf(&b, "- 个性签名：%s\n", data.Profile.Bio)
+	}
+	fmt.Fprintf(&b, "- 文章：%d 篇\n", len(data.Articles))
+	fmt.Fprintf(&b, "- 上传文件：%d 个\n\n", len(data.Media))
+	b.WriteString("| 文件 | 内容 |\n|---|---|\n")
+	b.WriteString("| account.json | 账号信息与角色 |\n")
+	b.WriteString("| profile.json | 公开资料 |\n")
+	b.WriteString("| articles.json | 全部文章（含草稿） |\n")
+	b.WriteString("| articles/*.md | 每篇文章的 Markdown |\n")
+	b.WriteString("| media.json | 上传到对象存储的文件名 |\n")
+	return b.String()
+}
+
+// Export 把用户数据打包成 zip 写入 w
+func Export(uid string, w io.Writer) error {
+	data, err := collect(uid)
+	if err != nil {
+		return fmt.Errorf("account_utils Export: %v", err)
+	}
+
+	archive := zip.NewWriter(w)
+
+	account := map[string]interface{}{
+		"account": data.Account,
+		"roles":   data.Roles,
+	}
+	if err := writeJSON(archive, "account.json", account); err != nil {
+		return fmt.Errorf("account_utils Export account.json: %v", err)
+	}
+	if err := writeJSON(archive, "profile.json", data.Profile); err != nil {
+		return fmt.Errorf("account_utils Export profile.json: %v", err)
+	}
+	if err := writeJSON(archive, "articles.json", data.Articles); err != nil {
+		return fmt.Errorf("account_utils Export articles.json: %v", err)
+	}
+	for _, article := range data.Articles {
+		if err := writeText(archive, fmt.Sprintf("articles/%s.md", article.Uuid), articleMarkdown(article)); err != nil {
+			return fmt.Errorf("account_utils Export article %s: %v", article.Uuid, err)
+		}
+	}
+	if err := writeJSON(archive, "media.json", data.Media); err != nil {
+		return fmt.Errorf("account_utils Export media.json: %v", err)
+	}
+	if err := writeText(archive, "README.md", readme(data)); err != nil {
+		return fmt.Errorf("account_utils Export README.md: %v", err)
+	}
+
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("account_utils Export Close: %v", err)
+	}
+	return nil
+}
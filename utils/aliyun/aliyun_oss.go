@@ -3,6 +3,8 @@ package aliyun
 import (
 	"fmt"
 	"io"
+	"net/url"
+	"strings"
 
 	"github.com/aliyun/aliyun-oss-go-sdk/oss"
 	"github.com/yux77yux/blog-backend/config"
@@ -49,3 +51,56 @@ func UploadFile(file io.Reader, objectName string) (string, error) {
 
 	return presignedURL, nil
 }
+
+func DeleteObjects(objectNames []string) error {
+	bucketName := "20240802"
+
+	client, err := oss.New(config.District, config.AccessKey_ID, config.AccessKey_Secret)
+	if err != nil {
+		return err
+	}
+
+	bucket, err := client.Bucket(bucketName)
+	if err != nil {
+		return err
+	}
+
+	// 单次最多删除 1000 个对象
+	for start := 0; start < len(objectNames); start += 1000 {
+		end := start + 1000
+		if end > len(objectNames) {
+			end = len(objectNames)
+		}
+		if _, err := bucket.DeleteObjects(objectNames[start:end], oss.DeleteObjectsQuiet(true)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ObjectNameFromURL 从上传返回的签名地址中取出对象名
+func ObjectNameFromURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(parsed.Path, "/")
+}
+
+// BucketObjectName 只在地址指向本站的存储空间时返回对象名，外部图片地址返回空字符串
+func BucketObjectName(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	// District 可能带有协议，例如 https://oss-cn-hangzhou.aliyuncs.com
+	endpoint := config.District
+	if withScheme, err := url.Parse(endpoint); err == nil && withScheme.Host != "" {
+		endpoint = withScheme.Host
+	}
+	if !strings.EqualFold(parsed.Hostname(), "20240802."+endpoint) {
+		return ""
+	}
+	return strings.TrimPrefix(parsed.Path, "/")
+}
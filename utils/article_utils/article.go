@@ -0,0 +1,412 @@
+package article_utils
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/yux77yux/blog-backend/config"
+	"github.com/yux77yux/blog-backend/internal/model"
+)
+
+// 文章状态，对应 article.status
+const (
+	StatusDraft     = 0
+	StatusPublished = 1
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+	// TINYTEXT 最多 255 字节
+	maxTitleBytes = 255
+	// 正文上限，MEDIUMTEXT 本身可以到 16MB
+	MaxContentBytes = 2 << 20
+	// uuid 冲突时的重试次数
+	uuidAttempts = 3
+)
+
+var (
+	ErrArticleNotFound = errors.New("article not found")
+	ErrTitleRequired   = errors.New("title is required")
+	ErrTitleTooLong    = errors.New("title is too long")
+	ErrContentTooLong  = errors.New("content is too long")
+)
+
+// NewUuid 生成 16 位十六进制的文章 ID
+func NewUuid() (string, error) {
+	bytes := make([]byte, 8)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("article_utils NewUuid: %v", err)
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// Validate 检查并整理客户端提交的字段
+func Validate(edit *model.ArticleEdit) error {
+	edit.Title = strings.TrimSpace(edit.Title)
+	if edit.Title == "" {
+		return ErrTitleRequired
+	}
+	if len(edit.Title) > maxTitleBytes {
+		return ErrTitleTooLong
+	}
+	if len(edit.Content) > MaxContentBytes {
+		return ErrContentTooLong
+	}
+	return validateTags(edit.Tags)
+}
+
+// AddArticle 以 uid 为作者创建草稿并保存第一个版本，uuid 与时间由服务端生成
+func AddArticle(uid string, edit *model.ArticleEdit, timezone string) (*model.Article, error) {
+	if err := Validate(edit); err != nil {
+		return nil, fmt.Errorf("article_utils AddArticle: %w", err)
+	}
+
+	config.OpenDB()
+	defer config.DB.Close()
+
+	query := `
+	INSERT INTO article (uuid, uid, title, titleLight, coverDimensions, coverImageUrl, summary, content, createdAt, updatedAt, timezone, tags, status) VALUES
+	(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	now := time.Now()
+	for attempt := 0; attempt < uuidAttempts; attempt++ {
+		uuid, err := NewUuid()
+		if err != nil {
+			return nil, fmt.Errorf("article_utils AddArticle: %v", err)
+		}
+
+		tx, err := config.DB.Begin()
+		if err != nil {
+			return nil, fmt.Errorf("article_utils AddArticle Begin: %v", err)
+		}
+
+		_, err = tx.Exec(query,
+			uuid,
+			uid,
+			edit.Title,
+			edit.TitleLight,
+			edit.CoverDimensions,
+			edit.CoverImageUrl,
+			edit.Summary,
+			edit.Content,
+			now,
+			now,
+			timezone,
+			edit.Tags,
+			StatusDraft,
+		)
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
+			tx.Rollback()
+			continue
+		}
+		if err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("article_utils AddArticle Exec: %v", err)
+		}
+
+		if err := syncTags(tx, uuid, edit.Tags); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("article_utils AddArticle %v", err)
+		}
+
+		if err := addRevision(tx, uuid, uid, 0, now); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("article_utils AddArticle %v", err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("article_utils AddArticle Commit: %v", err)
+		}
+
+		article, err := fetchArticle(uuid)
+		if err != nil {
+			return nil, fmt.Errorf("article_utils AddArticle: %w", err)
+		}
+		return article, nil
+	}
+
+	return nil, fmt.Errorf("article_utils AddArticle: uuid collision")
+}
+
+const articleColumns = `
+	article.uuid, article.uid, article.title, article.titleLight, article.coverDimensions, article.coverImageUrl,
+	article.summary, article.content, article.createdAt, article.updatedAt, article.timezone,
+	article.views, article.likes, article.tags, article.status, article.popularity,
+	article.publishedAt, article.scheduledAt
+	`
+
+// 作者的内容是否被隐藏，暂停到期后不再隐藏（user.status 1 为暂停）
+const authorHidden = `(user.contentHidden = 1 AND NOT IFNULL(user.status = 1 AND user.suspendedUntil <= NOW(), 0))`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanArticle(row scanner, extra ...interface{}) (*model.Article, error) {
+	var (
+		article     model.Article
+		tags        sql.NullString
+		publishedAt sql.NullString
+		scheduledAt sql.NullString
+	)
+	dest := []interface{}{
+		&article.Uuid,
+		&article.Uid,
+		&article.Title,
+		&article.TitleLight,
+		&article.CoverDimensions,
+		&article.CoverImageUrl,
+		&article.Summary,
+		&article.Content,
+		&article.CreatedAt,
+		&article.UpdatedAt,
+		&article.Timezone,
+		&article.Views,
+		&article.Likes,
+		&tags,
+		&article.Status,
+		&article.Popularity,
+		&publishedAt,
+		&scheduledAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	article.Tags = tags.String
+	article.PublishedAt = publishedAt.String
+	article.ScheduledAt = scheduledAt.String
+	return &article, nil
+}
+
+// 调用前需要已经 OpenDB
+func fetchArticle(uuid string) (*model.Article, error) {
+	article, _, err := fetchArticleWithAuthor(uuid)
+	return article, err
+}
+
+// 调用前需要已经 OpenDB，同时返回作者的内容是否被隐藏
+func fetchArticleWithAuthor(uuid string) (*model.Article, bool, error) {
+	query := `
+	SELECT ` + articleColumns + `, ` + authorHidden + `
+	FROM article
+	INNER JOIN user_incidental ON user_incidental.uid = article.uid
+	INNER JOIN user ON user.id = user_incidental.id
+	WHERE article.uuid = ? 
+	`
+
+	var hidden bool
+	article, err := scanArticle(config.DB.QueryRow(query, uuid), &hidden)
+	if err == sql.ErrNoRows {
+		return nil, false, ErrArticleNotFound
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("article_utils fetchArticle QueryRow: %v", err)
+	}
+	return article, hidden, nil
+}
+
+// FetchArticle 按 uuid 读取文章，同时返回作者的内容是否被管理员隐藏
+func FetchArticle(uuid string) (*model.Article, bool, error) {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	article, hidden, err := fetchArticleWithAuthor(uuid)
+	if err != nil {
+		return nil, false, fmt.Errorf("article_utils FetchArticle: %w", err)
+	}
+	return article, hidden, nil
+}
+
+type Filter struct {
+	// 非空时只返回该作者的文章
+	Uid string
+	// 非空时只返回带有该标签的文章，值为 slug
+	Tag string
+	// 为 true 时包含草稿和被隐藏作者的文章，只用于作者查看自己的文章
+	IncludeDrafts bool
+	Page          int
+	PageSize      int
+}
+
+// ListArticles 分页且不返回正文；公开列表按发布时间倒序，包含草稿时按创建时间倒序
+func ListArticles(filter Filter) (*model.ArticlePage, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 {
+		filter.PageSize = DefaultPageSize
+	}
+	if filter.PageSize > MaxPageSize {
+		filter.PageSize = MaxPageSize
+	}
+
+	conditions := []string{"1 = 1"}
+	args := []interface{}{}
+	if filter.Uid != "" {
+		conditions = append(conditions, "article.uid = ?")
+		args = append(args, filter.Uid)
+	}
+	if filter.Tag != "" {
+		conditions = append(conditions, `EXISTS (
+		SELECT 1 FROM article_tag
+		INNER JOIN tag ON tag.tagId = article_tag.tagId
+		WHERE article_tag.uuid = article.uuid AND tag.slug = ?)`)
+		args = append(args, filter.Tag)
+	}
+	if !filter.IncludeDrafts {
+		conditions = append(conditions, "article.status = ?", "NOT "+authorHidden)
+		args = append(args, StatusPublished)
+	}
+	where := strings.Join(conditions, " AND ")
+	order := "article.publishedAt DESC, article.uuid"
+	if filter.IncludeDrafts {
+		order = "article.createdAt DESC, article.uuid"
+	}
+
+	config.OpenDB()
+	defer config.DB.Close()
+
+	page := &model.ArticlePage{
+		Articles: []*model.Article{},
+		Page:     filter.Page,
+		PageSize: filter.PageSize,
+	}
+
+	query := `
+	SELECT COUNT(*)
+	FROM article
+	INNER JOIN user_incidental ON user_incidental.uid = article.uid
+	INNER JOIN user ON user.id = user_incidental.id
+	WHERE ` + where
+	if err := config.DB.QueryRow(query, args...).Scan(&page.Total); err != nil {
+		return nil, fmt.Errorf("article_utils ListArticles QueryRow: %v", err)
+	}
+
+	query = `
+	SELECT ` + articleColumns + `
+	FROM article
+	INNER JOIN user_incidental ON user_incidental.uid = article.uid
+	INNER JOIN user ON user.id = user_incidental.id
+	WHERE ` + where + `
+	ORDER BY ` + order + `
+	LIMIT ? OFFSET ?
+	`
+	args = append(args, filter.PageSize, (filter.Page-1)*filter.PageSize)
+
+	rows, err := config.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("article_utils ListArticles Query: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		article, err := scanArticle(rows)
+		if err != nil {
+			return nil, fmt.Errorf("article_utils ListArticles Scan: %v", err)
+		}
+		article.Content = ""
+		page.Articles = append(page.Articles, article)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("article_utils ListArticles rows: %v", err)
+	}
+
+	return page, nil
+}
+
+// UpdateArticle 修改可编辑的字段、刷新 updatedAt 并保存新版本，不改变发布状态；
+// editor 为保存者的 uid，作者权限由调用方检查
+func UpdateArticle(edit *model.ArticleEdit, editor string) (*model.Article, error) {
+	if err := Validate(edit); err != nil {
+		return nil, fmt.Errorf("article_utils UpdateArticle: %w", err)
+	}
+
+	config.OpenDB()
+	defer config.DB.Close()
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("article_utils UpdateArticle Begin: %v", err)
+	}
+
+	// 锁住文章行，同一篇文章的保存依次分配版本号
+	if err := lockArticle(tx, edit.Uuid); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("article_utils UpdateArticle %w", err)
+	}
+	if err := ensureBaseline(tx, edit.Uuid); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("article_utils UpdateArticle %v", err)
+	}
+
+	query := `
+	UPDATE article
+	SET title = ?, titleLight = ?, coverDimensions = ?, coverImageUrl = ?, summary = ?, content = ?,
+	tags = ?, updatedAt = ?
+	WHERE article.uuid = ? 
+	`
+
+	now := time.Now()
+	_, err = tx.Exec(query,
+		edit.Title,
+		edit.TitleLight,
+		edit.CoverDimensions,
+		edit.CoverImageUrl,
+		edit.Summary,
+		edit.Content,
+		edit.Tags,
+		now,
+		edit.Uuid,
+	)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("article_utils UpdateArticle Exec: %v", err)
+	}
+
+	if err := syncTags(tx, edit.Uuid, edit.Tags); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("article_utils UpdateArticle %v", err)
+	}
+
+	if err := addRevision(tx, edit.Uuid, editor, 0, now); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("article_utils UpdateArticle %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("article_utils UpdateArticle Commit: %v", err)
+	}
+
+	article, err := fetchArticle(edit.Uuid)
+	if err != nil {
+		return nil, fmt.Errorf("article_utils UpdateArticle: %w", err)
+	}
+	return article, nil
+}
+
+func DeleteArticle(uuid string) error {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	query := `
+	DELETE FROM article
+	WHERE article.uuid = ? 
+	`
+
+	result, err := config.DB.Exec(query, uuid)
+	if err != nil {
+		return fmt.Errorf("article_utils DeleteArticle Exec: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("article_utils DeleteArticle: %w", ErrArticleNotFound)
+	}
+	return nil
+}
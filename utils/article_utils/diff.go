@@ -0,0 +1,210 @@
+package article_utils
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/yux77yux/blog-backend/internal/model"
+)
+
+const (
+	DiffLine = "line"
+	DiffWord = "word"
+
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+
+	// 编辑距离或去掉相同首尾后的 token 数超过上限时不再逐个比较，整段替换，
+	// 限制任何人都能触发的 diff 的 CPU 开销；内存只与 maxDiffEdits 成正比
+	maxDiffEdits  = 1000
+	maxDiffTokens = 50000
+)
+
+var ErrDiffModeInvalid = errors.New("mode must be line or word")
+
+// 0 空白，1 字母数字，2 其他字符（标点、汉字等每个字符单独成段）
+func runeClass(r rune) int {
+	switch {
+	case unicode.IsSpace(r):
+		return 0
+	case (unicode.IsLetter(r) || unicode.IsDigit(r)) && !unicode.Is(unicode.Han, r):
+		return 1
+	default:
+		return 2
+	}
+}
+
+// 按行切分时保留换行符，按词切分时空白单独成段，拼接后与原文一致
+func tokenize(text string, mode string) []string {
+	if text == "" {
+		return nil
+	}
+	if mode == DiffLine {
+		tokens := strings.SplitAfter(text, "\n")
+		if tokens[len(tokens)-1] == "" {
+			tokens = tokens[:len(tokens)-1]
+		}
+		return tokens
+	}
+
+	tokens := []string{}
+	runes := []rune(text)
+	start := 0
+	for i := 1; i <= len(runes); i++ {
+		if i == len(runes) || runeClass(runes[i]) == 2 || runeClass(runes[i]) != runeClass(runes[i-1]) {
+			tokens = append(tokens, string(runes[start:i]))
+			start = i
+		}
+	}
+	return tokens
+}
+
+// 相邻的同类操作合并为一段
+func appendChunk(chunks []model.DiffChunk, op string, text string) []model.DiffChunk {
+	if text == "" {
+		return chunks
+	}
+	if n := len(chunks); n > 0 && chunks[n-1].Op == op {
+		chunks[n-1].Text += text
+		return chunks
+	}
+	return append(chunks, model.DiffChunk{Op: op, Text: text})
+}
+
+// Diff 使用线性空间的 Myers 算法比较两段文本，mode 为 line 或 word
+func Diff(from string, to string, mode string) ([]model.DiffChunk, error) {
+	if mode != DiffLine && mode != DiffWord {
+		return nil, ErrDiffModeInvalid
+	}
+
+	d := &differ{chunks: []model.DiffChunk{}}
+	a, b := tokenize(from, mode), tokenize(to, mode)
+	prefix, suffix := commonAffixes(a, b)
+	d.emit(DiffEqual, a[:prefix])
+
+	middleA, middleB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(middleA)+len(middleB) > maxDiffTokens || !d.run(middleA, middleB) {
+		d.emit(DiffDelete, middleA)
+		d.emit(DiffInsert, middleB)
+	}
+
+	d.emit(DiffEqual, a[len(a)-suffix:])
+	return d.chunks, nil
+}
+
+func commonAffixes(a []string, b []string) (int, int) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	return prefix, suffix
+}
+
+type differ struct {
+	chunks []model.DiffChunk
+}
+
+func (d *differ) emit(op string, tokens []string) {
+	d.chunks = appendChunk(d.chunks, op, strings.Join(tokens, ""))
+}
+
+// run 分治：找到中间蛇后递归比较两侧；编辑距离超过 maxDiffEdits 时返回 false 且不输出
+func (d *differ) run(a []string, b []string) bool {
+	prefix, suffix := commonAffixes(a, b)
+	middleA, middleB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	switch {
+	case len(middleA) == 0 && len(middleB) == 0:
+	case len(middleA) == 0 || len(middleB) == 0:
+		d.emit(DiffEqual, a[:prefix])
+		d.emit(DiffDelete, middleA)
+		d.emit(DiffInsert, middleB)
+		d.emit(DiffEqual, a[len(a)-suffix:])
+		return true
+	default:
+		x, y, u, v, ok := middleSnake(middleA, middleB)
+		if !ok {
+			return false
+		}
+		d.emit(DiffEqual, a[:prefix])
+		// 两侧的编辑距离都小于当前，不会再超过上限
+		d.run(middleA[:x], middleB[:y])
+		d.emit(DiffEqual, middleA[x:u])
+		d.run(middleA[u:], middleB[v:])
+		d.emit(DiffEqual, a[len(a)-suffix:])
+		return true
+	}
+
+	d.emit(DiffEqual, a)
+	return true
+}
+
+// middleSnake 同时从两端搜索，返回最短编辑路径中间那段相同的部分 a[x:u] == b[y:v]；
+// 只保留两条长度为 O(maxDiffEdits) 的对角线数组
+func middleSnake(a []string, b []string) (int, int, int, int, bool) {
+	n, m := len(a), len(b)
+	delta := n - m
+	odd := delta%2 != 0
+
+	limit := (n + m + 1) / 2
+	if limit > maxDiffEdits {
+		limit = maxDiffEdits
+	}
+	offset := limit + 1
+	// forward[k] 为正向在对角线 k 上到达的最远 x，backward[k] 为反向（两串都倒序）到达的最远 x
+	forward := make([]int, 2*limit+3)
+	backward := make([]int, 2*limit+3)
+
+	for step := 0; step <= limit; step++ {
+		for k := -step; k <= step; k += 2 {
+			var x int
+			if k == -step || (k != step && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+
+			if reverseK := delta - k; odd && reverseK >= -(step-1) && reverseK <= step-1 {
+				if x+backward[offset+reverseK] >= n {
+					return startX, startY, x, y, true
+				}
+			}
+		}
+
+		for k := -step; k <= step; k += 2 {
+			var x int
+			if k == -step || (k != step && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && a[n-1-x] == b[m-1-y] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+
+			if forwardK := delta - k; !odd && forwardK >= -step && forwardK <= step {
+				if x+forward[offset+forwardK] >= n {
+					return n - x, m - y, n - startX, m - startY, true
+				}
+			}
+		}
+	}
+	return 0, 0, 0, 0, false
+}
@@ -0,0 +1,144 @@
+package article_utils
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yux77yux/blog-backend/config"
+	"github.com/yux77yux/blog-backend/internal/model"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+	"github.com/yux77yux/blog-backend/utils/redis_utils"
+)
+
+// 定时发布的检查间隔，也是发布时间的最大误差
+const publishInterval = time.Minute
+
+var (
+	ErrAlreadyPublished = errors.New("article is already published")
+	ErrScheduleInPast   = errors.New("publish time must be in the future")
+)
+
+// PublishArticle 立即发布；首次发布时记录 publishedAt，重新发布保留原来的发布时间
+func PublishArticle(uuid string) (*model.Article, error) {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	query := `
+	UPDATE article
+	SET status = ?, publishedAt = COALESCE(publishedAt, ?), scheduledAt = NULL
+	WHERE article.uuid = ?
+	AND article.status = ?
+	`
+
+	result, err := config.DB.Exec(query, StatusPublished, time.Now(), uuid, StatusDraft)
+	if err != nil {
+		return nil, fmt.Errorf("article_utils PublishArticle Exec: %v", err)
+	}
+
+	article, err := fetchArticle(uuid)
+	if err != nil {
+		return nil, fmt.Errorf("article_utils PublishArticle: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return nil, fmt.Errorf("article_utils PublishArticle: %w", ErrAlreadyPublished)
+	}
+	return article, nil
+}
+
+// UnpublishArticle 撤回为草稿，同时取消定时发布；已是草稿时不报错
+func UnpublishArticle(uuid string) (*model.Article, error) {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	query := `
+	UPDATE article
+	SET status = ?, scheduledAt = NULL
+	WHERE article.uuid = ?
+	`
+
+	if _, err := config.DB.Exec(query, StatusDraft, uuid); err != nil {
+		return nil, fmt.Errorf("article_utils UnpublishArticle Exec: %v", err)
+	}
+
+	article, err := fetchArticle(uuid)
+	if err != nil {
+		return nil, fmt.Errorf("article_utils UnpublishArticle: %w", err)
+	}
+	return article, nil
+}
+
+// ScheduleArticle 安排草稿在 at 发布，重复调用会覆盖之前的时间
+func ScheduleArticle(uuid string, at time.Time) (*model.Article, error) {
+	if !at.After(time.Now()) {
+		return nil, fmt.Errorf("article_utils ScheduleArticle: %w", ErrScheduleInPast)
+	}
+
+	config.OpenDB()
+	defer config.DB.Close()
+
+	query := `
+	UPDATE article
+	SET scheduledAt = ?
+	WHERE article.uuid = ?
+	AND article.status = ?
+	`
+
+	result, err := config.DB.Exec(query, at, uuid, StatusDraft)
+	if err != nil {
+		return nil, fmt.Errorf("article_utils ScheduleArticle Exec: %v", err)
+	}
+
+	article, err := fetchArticle(uuid)
+	if err != nil {
+		return nil, fmt.Errorf("article_utils ScheduleArticle: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 && article.Status != StatusDraft {
+		return nil, fmt.Errorf("article_utils ScheduleArticle: %w", ErrAlreadyPublished)
+	}
+	return article, nil
+}
+
+// 发布所有到期的草稿，publishedAt 取安排的时间而不是实际执行的时间
+func publishDue() (int64, error) {
+	// 多个实例只需要一个执行
+	ok, err := redis_utils.AcquireThrottle("article_publish", publishInterval-time.Second*5)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, nil
+	}
+
+	config.OpenDB()
+	defer config.DB.Close()
+
+	query := `
+	UPDATE article
+	SET status = ?, publishedAt = COALESCE(publishedAt, scheduledAt), scheduledAt = NULL
+	WHERE article.status = ?
+	AND article.scheduledAt <= ?
+	`
+
+	result, err := config.DB.Exec(query, StatusPublished, StatusDraft, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("article_utils publishDue Exec: %v", err)
+	}
+	return result.RowsAffected()
+}
+
+func SchedulePublishing() {
+	ticker := time.NewTicker(publishInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		published, err := publishDue()
+		if err != nil {
+			log_utils.Logger.Printf("Error: article_utils publishing scheduled articles: %v", err)
+			continue
+		}
+		if published > 0 {
+			log_utils.Logger.Printf("article_utils SchedulePublishing: published %d articles", published)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package article_utils
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yux77yux/blog-backend/config"
+	"github.com/yux77yux/blog-backend/internal/model"
+)
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// 锁住文章行直到事务结束
+func lockArticle(tx *sql.Tx, uuid string) error {
+	query := `
+	SELECT article.uuid
+	FROM article
+	WHERE article.uuid = ?
+	FOR UPDATE
+	`
+
+	var locked string
+	err := tx.QueryRow(query, uuid).Scan(&locked)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("lockArticle: %w", ErrArticleNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("lockArticle QueryRow: %v", err)
+	}
+	return nil
+}
+
+// 版本功能上线前创建的文章没有任何版本，修改前先把当前内容保存为第 1 版
+func ensureBaseline(tx *sql.Tx, uuid string) error {
+	query := `
+	INSERT INTO article_revision (uuid, revision, editor, title, summary, content, tags, createdAt)
+	SELECT article.uuid, 1, article.uid, article.title, article.summary, article.content, article.tags, article.updatedAt
+	FROM article
+	WHERE article.uuid = ?
+	AND NOT EXISTS (SELECT 1 FROM article_revision WHERE article_revision.uuid = ?)
+	`
+	if _, err := tx.Exec(query, uuid, uuid); err != nil {
+		return fmt.Errorf("ensureBaseline Exec: %v", err)
+	}
+	return nil
+}
+
+// 把文章当前的内容保存为下一个版本，restoredFrom 为 0 表示普通保存
+func addRevision(tx *sql.Tx, uuid string, editor string, restoredFrom int, now time.Time) error {
+	query := `
+	INSERT INTO article_revision (uuid, revision, editor, title, summary, content, tags, createdAt, restoredFrom)
+	SELECT article.uuid,
+	(SELECT COALESCE(MAX(article_revision.revision), 0) + 1 FROM article_revision WHERE article_revision.uuid = ?),
+	?, article.title, article.summary, article.content, article.tags, ?, ?
+	FROM article
+	WHERE article.uuid = ?
+	`
+
+	restored := sql.NullInt64{Int64: int64(restoredFrom), Valid: restoredFrom != 0}
+	result, err := tx.Exec(query, uuid, editor, now, restored, uuid)
+	if err != nil {
+		return fmt.Errorf("addRevision Exec: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("addRevision: %w", ErrArticleNotFound)
+	}
+	return nil
+}
+
+func scanRevision(row scanner, withContent bool) (*model.ArticleRevision, error) {
+	var (
+		revision     model.ArticleRevision
+		tags         sql.NullString
+		restoredFrom sql.NullInt64
+	)
+	dest := []interface{}{
+		&revision.Uuid,
+		&revision.Revision,
+		&revision.Editor,
+		&revision.Title,
+		&revision.Summary,
+		&tags,
+		&revision.CreatedAt,
+		&restoredFrom,
+	}
+	if withContent {
+		dest = append(dest, &revision.Content)
+	}
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	revision.Tags = tags.String
+	revision.RestoredFrom = int(restoredFrom.Int64)
+	return &revision, nil
+}
+
+const revisionColumns = `
+	article_revision.uuid, article_revision.revision, article_revision.editor, article_revision.title,
+	article_revision.summary, article_revision.tags, article_revision.createdAt, article_revision.restoredFrom
+	`
+
+// FetchRevisions 按版本号倒序分页，列表不返回正文
+func FetchRevisions(uuid string, page int, pageSize int) (*model.ArticleRevisionPage, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = DefaultPageSize
+	}
+	if pageSize > MaxPageSize {
+		pageSize = MaxPageSize
+	}
+
+	config.OpenDB()
+	defer config.DB.Close()
+
+	revisions := &model.ArticleRevisionPage{
+		Revisions: []*model.ArticleRevision{},
+		Page:      page,
+		PageSize:  pageSize,
+	}
+
+	query := `
+	SELECT COUNT(*)
+	FROM article_revision
+	WHERE article_revision.uuid = ?
+	`
+	if err := config.DB.QueryRow(query, uuid).Scan(&revisions.Total); err != nil {
+		return nil, fmt.Errorf("article_utils FetchRevisions QueryRow: %v", err)
+	}
+
+	query = `
+	SELECT ` + revisionColumns + `
+	FROM article_revision
+	WHERE article_revision.uuid = ?
+	ORDER BY article_revision.revision DESC
+	LIMIT ? OFFSET ?
+	`
+
+	rows, err := config.DB.Query(query, uuid, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, fmt.Errorf("article_utils FetchRevisions Query: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		revision, err := scanRevision(rows, false)
+		if err != nil {
+			return nil, fmt.Errorf("article_utils FetchRevisions Scan: %v", err)
+		}
+		revisions.Revisions = append(revisions.Revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("article_utils FetchRevisions rows: %v", err)
+	}
+
+	return revisions, nil
+}
+
+// 调用前需要已经 OpenDB
+func fetchRevision(uuid string, number int) (*model.ArticleRevision, error) {
+	query := `
+	SELECT ` + revisionColumns + `, article_revision.content
+	FROM article_revision
+	WHERE article_revision.uuid = ?
+	AND article_revision.revision = ?
+	`
+
+	revision, err := scanRevision(config.DB.QueryRow(query, uuid, number), true)
+	if err == sql.ErrNoRows {
+		return nil, ErrRevisionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fetchRevision QueryRow: %v", err)
+	}
+	return revision, nil
+}
+
+// FetchRevision 读取某个版本的完整内容
+func FetchRevision(uuid string, number int) (*model.ArticleRevision, error) {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	revision, err := fetchRevision(uuid, number)
+	if err != nil {
+		return nil, fmt.Errorf("article_utils FetchRevision: %w", err)
+	}
+	return revision, nil
+}
+
+// DiffRevisions 比较两个版本，from 与 to 不要求先后顺序
+func DiffRevisions(uuid string, from int, to int, mode string) (*model.ArticleDiff, error) {
+	if mode != DiffLine && mode != DiffWord {
+		return nil, fmt.Errorf("article_utils DiffRevisions: %w", ErrDiffModeInvalid)
+	}
+
+	config.OpenDB()
+	defer config.DB.Close()
+
+	older, err := fetchRevision(uuid, from)
+	if err != nil {
+		return nil, fmt.Errorf("article_utils DiffRevisions: %w", err)
+	}
+	newer, err := fetchRevision(uuid, to)
+	if err != nil {
+		return nil, fmt.Errorf("article_utils DiffRevisions: %w", err)
+	}
+
+	diff := &model.ArticleDiff{Uuid: uuid, From: from, To: to, Mode: mode}
+	// 标题、摘要和标签都很短，总是按词比较
+	diff.Title, _ = Diff(older.Title, newer.Title, DiffWord)
+	diff.Summary, _ = Diff(older.Summary, newer.Summary, DiffWord)
+	diff.Tags, _ = Diff(older.Tags, newer.Tags, DiffWord)
+	diff.Content, _ = Diff(older.Content, newer.Content, mode)
+	return diff, nil
+}
+
+// RestoreRevision 把文章恢复到某个版本并保存为新的版本，历史版本本身不会被修改
+func RestoreRevision(uuid string, number int, editor string) (*model.Article, error) {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	revision, err := fetchRevision(uuid, number)
+	if err != nil {
+		return nil, fmt.Errorf("article_utils RestoreRevision: %w", err)
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("article_utils RestoreRevision Begin: %v", err)
+	}
+
+	if err := lockArticle(tx, uuid); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("article_utils RestoreRevision %w", err)
+	}
+
+	query := `
+	UPDATE article
+	SET title = ?, summary = ?, content = ?, tags = ?, updatedAt = ?
+	WHERE article.uuid = ?
+	`
+
+	now := time.Now()
+	_, err = tx.Exec(query,
+		revision.Title,
+		revision.Summary,
+		revision.Content,
+		revision.Tags,
+		now,
+		uuid,
+	)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("article_utils RestoreRevision Exec: %v", err)
+	}
+
+	if err := syncTags(tx, uuid, revision.Tags); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("article_utils RestoreRevision %v", err)
+	}
+
+	if err := addRevision(tx, uuid, editor, number, now); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("article_utils RestoreRevision %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("article_utils RestoreRevision Commit: %v", err)
+	}
+
+	article, err := fetchArticle(uuid)
+	if err != nil {
+		return nil, fmt.Errorf("article_utils RestoreRevision: %w", err)
+	}
+	return article, nil
+}
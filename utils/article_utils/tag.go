@@ -0,0 +1,252 @@
+package article_utils
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yux77yux/blog-backend/config"
+	"github.com/yux77yux/blog-backend/internal/model"
+)
+
+const (
+	// 每篇文章最多的标签数
+	MaxTags = 10
+	// 单个标签的最大字符数
+	maxTagRunes      = 32
+	DefaultTagsLimit = 100
+)
+
+var (
+	ErrTooManyTags = errors.New("an article can have at most 10 tags")
+	ErrTagTooLong  = errors.New("tag is too long")
+	ErrTagNotFound = errors.New("tag not found")
+)
+
+// 全角字符转为半角，例如 "ＧＯ" -> "GO"、全角空格 -> 空格、"，" -> ","
+func foldWidth(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '　':
+			return ' '
+		case r >= '！' && r <= '～':
+			return r - 0xFEE0
+		}
+		return r
+	}, value)
+}
+
+// NormalizeTag 返回标签的 slug 与展示名，slug 统一大小写、全角和空白并去掉开头的 #，
+// 如 " Ｇｏ  Lang " -> "go-lang"、"#C#" -> "c#"
+func NormalizeTag(name string) (string, string) {
+	fields := strings.Fields(strings.TrimLeft(strings.TrimSpace(foldWidth(name)), "#"))
+	display := strings.Join(fields, " ")
+	slug := strings.ToLower(strings.Join(fields, "-"))
+	return slug, display
+}
+
+// ParseTags 解析 article.tags，兼容 JSON 数组与逗号、顿号、分号、换行分隔的文本，按 slug 去重；
+// # 不作分隔符，否则 C#、F# 会被拆开
+func ParseTags(tags string) []model.Tag {
+	values := []string{}
+	if err := json.Unmarshal([]byte(tags), &values); err != nil {
+		values = strings.FieldsFunc(foldWidth(tags), func(r rune) bool {
+			return r == ',' || r == '、' || r == ';' || r == '\n'
+		})
+	}
+
+	parsed := []model.Tag{}
+	seen := map[string]bool{}
+	for _, value := range values {
+		slug, display := NormalizeTag(value)
+		if slug == "" || seen[slug] {
+			continue
+		}
+		seen[slug] = true
+		parsed = append(parsed, model.Tag{Slug: slug, Name: display})
+	}
+	return parsed
+}
+
+func validateTags(tags string) error {
+	parsed := ParseTags(tags)
+	if len(parsed) > MaxTags {
+		return ErrTooManyTags
+	}
+	for _, tag := range parsed {
+		if utf8.RuneCountInString(tag.Slug) > maxTagRunes {
+			return ErrTagTooLong
+		}
+	}
+	return nil
+}
+
+// 用 tags 重建文章与标签的关联；历史数据中超长或超出数量的标签直接跳过
+func syncTags(tx *sql.Tx, uuid string, tags string) error {
+	query := `
+	DELETE FROM article_tag
+	WHERE article_tag.uuid = ?
+	`
+	if _, err := tx.Exec(query, uuid); err != nil {
+		return fmt.Errorf("syncTags Exec: %v", err)
+	}
+
+	count := 0
+	for _, tag := range ParseTags(tags) {
+		if count == MaxTags {
+			break
+		}
+		if utf8.RuneCountInString(tag.Slug) > maxTagRunes {
+			continue
+		}
+
+		// 已存在时通过 LAST_INSERT_ID 取回原来的 tagId
+		query = `
+		INSERT INTO tag (slug, name) VALUES
+		(?, ?)
+		ON DUPLICATE KEY UPDATE tagId = LAST_INSERT_ID(tagId)
+		`
+		result, err := tx.Exec(query, tag.Slug, tag.Name)
+		if err != nil {
+			return fmt.Errorf("syncTags Exec: %v", err)
+		}
+		tagId, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("syncTags LastInsertId: %v", err)
+		}
+
+		query = `
+		INSERT INTO article_tag (uuid, tagId) VALUES
+		(?, ?)
+		`
+		if _, err := tx.Exec(query, uuid, tagId); err != nil {
+			return fmt.Errorf("syncTags Exec: %v", err)
+		}
+		count++
+	}
+	return nil
+}
+
+// MigrateTags 把还没有关联记录的文章的 tags 文本解析进 tag 与 article_tag，可重复执行
+func MigrateTags(db *sql.DB) (int, error) {
+	query := `
+	SELECT article.uuid, article.tags
+	FROM article
+	WHERE article.tags IS NOT NULL
+	AND article.tags <> ''
+	AND NOT EXISTS (SELECT 1 FROM article_tag WHERE article_tag.uuid = article.uuid)
+	`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return 0, fmt.Errorf("article_utils MigrateTags Query: %v", err)
+	}
+	pending := map[string]string{}
+	for rows.Next() {
+		var uuid, tags string
+		if err := rows.Scan(&uuid, &tags); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("article_utils MigrateTags Scan: %v", err)
+		}
+		pending[uuid] = tags
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("article_utils MigrateTags rows: %v", err)
+	}
+
+	migrated := 0
+	for uuid, tags := range pending {
+		tx, err := db.Begin()
+		if err != nil {
+			return migrated, fmt.Errorf("article_utils MigrateTags Begin: %v", err)
+		}
+		if err := syncTags(tx, uuid, tags); err != nil {
+			tx.Rollback()
+			return migrated, fmt.Errorf("article_utils MigrateTags %s %v", uuid, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return migrated, fmt.Errorf("article_utils MigrateTags Commit: %v", err)
+		}
+		migrated++
+	}
+	return migrated, nil
+}
+
+// FetchTags 按已发布文章数倒序列出标签，不含没有公开文章的标签
+func FetchTags(limit int) ([]model.Tag, error) {
+	if limit < 1 || limit > DefaultTagsLimit {
+		limit = DefaultTagsLimit
+	}
+
+	config.OpenDB()
+	defer config.DB.Close()
+
+	query := `
+	SELECT tag.slug, tag.name, COUNT(*) AS articles
+	FROM tag
+	INNER JOIN article_tag ON article_tag.tagId = tag.tagId
+	INNER JOIN article ON article.uuid = article_tag.uuid
+	INNER JOIN user_incidental ON user_incidental.uid = article.uid
+	INNER JOIN user ON user.id = user_incidental.id
+	WHERE article.status = ?
+	AND NOT ` + authorHidden + `
+	GROUP BY tag.tagId, tag.slug, tag.name
+	ORDER BY articles DESC, tag.slug
+	LIMIT ?
+	`
+
+	rows, err := config.DB.Query(query, StatusPublished, limit)
+	if err != nil {
+		return nil, fmt.Errorf("article_utils FetchTags Query: %v", err)
+	}
+	defer rows.Close()
+
+	tags := []model.Tag{}
+	for rows.Next() {
+		var tag model.Tag
+		if err := rows.Scan(&tag.Slug, &tag.Name, &tag.Count); err != nil {
+			return nil, fmt.Errorf("article_utils FetchTags Scan: %v", err)
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("article_utils FetchTags rows: %v", err)
+	}
+	return tags, nil
+}
+
+// FetchTag 按 slug 读取标签及其已发布文章数，slug 会先规范化
+func FetchTag(slug string) (*model.Tag, error) {
+	slug, _ = NormalizeTag(slug)
+
+	config.OpenDB()
+	defer config.DB.Close()
+
+	query := `
+	SELECT tag.slug, tag.name,
+	(SELECT COUNT(*)
+	FROM article_tag
+	INNER JOIN article ON article.uuid = article_tag.uuid
+	INNER JOIN user_incidental ON user_incidental.uid = article.uid
+	INNER JOIN user ON user.id = user_incidental.id
+	WHERE article_tag.tagId = tag.tagId
+	AND article.status = ?
+	AND NOT ` + authorHidden + `)
+	FROM tag
+	WHERE tag.slug = ?
+	`
+
+	var tag model.Tag
+	err := config.DB.QueryRow(query, StatusPublished, slug).Scan(&tag.Slug, &tag.Name, &tag.Count)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("article_utils FetchTag: %w", ErrTagNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("article_utils FetchTag QueryRow: %v", err)
+	}
+	return &tag, nil
+}
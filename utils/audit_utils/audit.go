@@ -0,0 +1,262 @@
+package audit_utils
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yux77yux/blog-backend/config"
+	"github.com/yux77yux/blog-backend/internal/model"
+	"github.com/yux77yux/blog-backend/utils/ipinfo"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+)
+
+// 审计事件的 action
+const (
+	ActionSignIn           = "sign_in"
+	ActionSignInFailed     = "sign_in_failed"
+	ActionSignInSuspicious = "sign_in_suspicious"
+	ActionSignOut          = "sign_out"
+	ActionNameChange       = "name_change"
+	ActionBioChange        = "bio_change"
+	ActionProfileChange    = "profile_change"
+	ActionPasswordChange   = "password_change"
+	ActionPasswordReset    = "password_reset"
+	ActionEmailChange      = "email_change"
+	ActionEmailVerify      = "email_verify"
+	ActionSessionRevoke    = "session_revoke"
+	ActionTotpEnable       = "totp_enable"
+	ActionTotpDisable      = "totp_disable"
+	ActionPasskeyAdd       = "passkey_add"
+	ActionPasskeyDelete    = "passkey_delete"
+	ActionTokenCreate      = "token_create"
+	ActionTokenRevoke      = "token_revoke"
+	ActionRoleGrant        = "role_grant"
+	ActionRoleRevoke       = "role_revoke"
+	ActionSuspend          = "account_suspend"
+	ActionBan              = "account_ban"
+	ActionReinstate        = "account_reinstate"
+	ActionDeletionRequest  = "account_deletion_request"
+	ActionDeletionCancel   = "account_deletion_cancel"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+type Event struct {
+	ActorUid  string
+	Action    string
+	TargetUid string
+	Target    string
+	Before    string
+	After     string
+}
+
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+func truncate(value string, n int) string {
+	if len(value) <= n {
+		return value
+	}
+	return value[:n]
+}
+
+// Record 追加一条审计事件，IP 与 User-Agent 取自请求；写入失败只记日志，不影响业务
+func Record(r *http.Request, event Event) {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	query := `
+	INSERT INTO audit_event (actorUid, action, targetUid, target, ip, userAgent, beforeValue, afterValue, createdAt) VALUES
+	(?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := config.DB.Exec(query,
+		nullString(event.ActorUid),
+		event.Action,
+		nullString(event.TargetUid),
+		truncate(event.Target, 255),
+		ipinfo.GetClientIP(r),
+		truncate(r.UserAgent(), 512),
+		nullString(event.Before),
+		nullString(event.After),
+		time.Now(),
+	)
+	if err != nil {
+		log_utils.Logger.Printf("Error: audit_utils Record %s: %v", event.Action, err)
+	}
+}
+
+type Filter struct {
+	// 非空时只返回该用户作为执行者或被操作者的事件
+	Uid       string
+	ActorUid  string
+	TargetUid string
+	Action    string
+	From      time.Time
+	To        time.Time
+	Page      int
+	PageSize  int
+}
+
+var ErrFilterInvalid = errors.New("invalid audit filter")
+
+// 时间参数接受 RFC3339 或日期，只给日期时 to 包含当天
+func parseTime(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// ParseFilter 从查询参数解析 action、from、to、page、pageSize，用户相关的条件由调用方填写
+func ParseFilter(values url.Values) (Filter, error) {
+	filter := Filter{Action: values.Get("action")}
+
+	var err error
+	if from := values.Get("from"); from != "" {
+		if filter.From, err = parseTime(from, false); err != nil {
+			return filter, fmt.Errorf("audit_utils ParseFilter from: %w", ErrFilterInvalid)
+		}
+	}
+	if to := values.Get("to"); to != "" {
+		if filter.To, err = parseTime(to, true); err != nil {
+			return filter, fmt.Errorf("audit_utils ParseFilter to: %w", ErrFilterInvalid)
+		}
+	}
+	if page := values.Get("page"); page != "" {
+		if filter.Page, err = strconv.Atoi(page); err != nil {
+			return filter, fmt.Errorf("audit_utils ParseFilter page: %w", ErrFilterInvalid)
+		}
+	}
+	if pageSize := values.Get("pageSize"); pageSize != "" {
+		if filter.PageSize, err = strconv.Atoi(pageSize); err != nil {
+			return filter, fmt.Errorf("audit_utils ParseFilter pageSize: %w", ErrFilterInvalid)
+		}
+	}
+
+	return filter, nil
+}
+
+// Query 按时间倒序分页查询
+func Query(filter Filter) (*model.AuditPage, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 {
+		filter.PageSize = DefaultPageSize
+	}
+	if filter.PageSize > MaxPageSize {
+		filter.PageSize = MaxPageSize
+	}
+
+	conditions := []string{"1 = 1"}
+	args := []interface{}{}
+	if filter.Uid != "" {
+		conditions = append(conditions, "(audit_event.actorUid = ? OR audit_event.targetUid = ?)")
+		args = append(args, filter.Uid, filter.Uid)
+	}
+	if filter.ActorUid != "" {
+		conditions = append(conditions, "audit_event.actorUid = ?")
+		args = append(args, filter.ActorUid)
+	}
+	if filter.TargetUid != "" {
+		conditions = append(conditions, "audit_event.targetUid = ?")
+		args = append(args, filter.TargetUid)
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, "audit_event.action = ?")
+		args = append(args, filter.Action)
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "audit_event.createdAt >= ?")
+		args = append(args, filter.From)
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "audit_event.createdAt < ?")
+		args = append(args, filter.To)
+	}
+	where := strings.Join(conditions, " AND ")
+
+	config.OpenDB()
+	defer config.DB.Close()
+
+	page := &model.AuditPage{
+		Events:   []*model.AuditEvent{},
+		Page:     filter.Page,
+		PageSize: filter.PageSize,
+	}
+
+	query := fmt.Sprintf(`
+	SELECT COUNT(*)
+	FROM audit_event
+	WHERE %s
+	`, where)
+	if err := config.DB.QueryRow(query, args...).Scan(&page.Total); err != nil {
+		return nil, fmt.Errorf("audit_utils Query QueryRow: %v", err)
+	}
+
+	query = fmt.Sprintf(`
+	SELECT 
+	eventId, actorUid, action, targetUid, target, ip, userAgent, beforeValue, afterValue, createdAt
+	FROM audit_event
+	WHERE %s
+	ORDER BY audit_event.eventId DESC
+	LIMIT ? OFFSET ?
+	`, where)
+	args = append(args, filter.PageSize, (filter.Page-1)*filter.PageSize)
+
+	rows, err := config.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("audit_utils Query Query: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			event                              model.AuditEvent
+			actorUid, targetUid, before, after sql.NullString
+		)
+		err := rows.Scan(
+			&event.EventId,
+			&actorUid,
+			&event.Action,
+			&targetUid,
+			&event.Target,
+			&event.IP,
+			&event.UserAgent,
+			&before,
+			&after,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("audit_utils Query Scan: %v", err)
+		}
+		event.ActorUid = actorUid.String
+		event.TargetUid = targetUid.String
+		event.Before = before.String
+		event.After = after.String
+		page.Events = append(page.Events, &event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("audit_utils Query rows: %v", err)
+	}
+
+	return page, nil
+}
@@ -2,13 +2,108 @@ package database_utils
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/yux77yux/blog-backend/config"
+	"github.com/yux77yux/blog-backend/utils/article_utils"
 	"github.com/yux77yux/blog-backend/utils/log_utils"
+	"github.com/yux77yux/blog-backend/utils/rbac_utils"
 )
 
+// MySQL 不支持 ADD COLUMN IF NOT EXISTS，先查 information_schema
+func addColumnIfMissing(db *sql.DB, table string, column string, definition string) {
+	query := `
+	SELECT COUNT(*)
+	FROM information_schema.COLUMNS
+	WHERE TABLE_SCHEMA = DATABASE()
+	AND TABLE_NAME = ?
+	AND COLUMN_NAME = ?
+	`
+
+	var count int
+	if err := db.QueryRow(query, table, column).Scan(&count); err != nil {
+		log.Fatal(err)
+		log_utils.Logger.Printf("check %s.%s column failure: %v", table, column, err)
+	}
+	if count > 0 {
+		return
+	}
+
+	query = fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)
+	if _, err := db.Exec(query); err != nil {
+		log.Fatal(err)
+		log_utils.Logger.Printf("add %s.%s column failure: %v", table, column, err)
+	}
+}
+
+func addIndexIfMissing(db *sql.DB, table string, index string, definition string) {
+	query := `
+	SELECT COUNT(*)
+	FROM information_schema.STATISTICS
+	WHERE TABLE_SCHEMA = DATABASE()
+	AND TABLE_NAME = ?
+	AND INDEX_NAME = ?
+	`
+
+	var count int
+	if err := db.QueryRow(query, table, index).Scan(&count); err != nil {
+		log.Fatal(err)
+		log_utils.Logger.Printf("check %s.%s index failure: %v", table, index, err)
+	}
+	if count > 0 {
+		return
+	}
+
+	query = fmt.Sprintf("ALTER TABLE %s ADD %s", table, definition)
+	if _, err := db.Exec(query); err != nil {
+		log.Fatal(err)
+		log_utils.Logger.Printf("add %s.%s index failure: %v", table, index, err)
+	}
+}
+
+// 写入内置角色与权限，已有的不会重复插入；没有任何角色的旧账号补上默认角色
+func seedRoles(db *sql.DB) {
+	for role, permissions := range rbac_utils.DefaultRoles {
+		if _, err := db.Exec("INSERT IGNORE INTO role (name) VALUES (?)", role); err != nil {
+			log.Fatal(err)
+			log_utils.Logger.Printf("seed role %s failure: %v", role, err)
+		}
+
+		for _, permission := range permissions {
+			if _, err := db.Exec("INSERT IGNORE INTO permission (name) VALUES (?)", permission); err != nil {
+				log.Fatal(err)
+				log_utils.Logger.Printf("seed permission %s failure: %v", permission, err)
+			}
+
+			query := `
+	INSERT IGNORE INTO role_permission (roleId, permissionId)
+	SELECT role.roleId, permission.permissionId
+	FROM role, permission
+	WHERE role.name = ? 
+	AND permission.name = ? 
+	`
+			if _, err := db.Exec(query, role, permission); err != nil {
+				log.Fatal(err)
+				log_utils.Logger.Printf("seed role_permission %s %s failure: %v", role, permission, err)
+			}
+		}
+	}
+
+	query := `
+	INSERT IGNORE INTO user_role (id, roleId, grantedAt)
+	SELECT user.id, role.roleId, NOW()
+	FROM user, role
+	WHERE role.name = ? 
+	AND NOT EXISTS (SELECT 1 FROM user_role WHERE user_role.id = user.id)
+	`
+	if _, err := db.Exec(query, rbac_utils.DefaultRole); err != nil {
+		log.Fatal(err)
+		log_utils.Logger.Printf("seed default user_role failure: %v", err)
+	}
+}
+
 func CreateTables() {
 	db, err := sql.Open("mysql", "sa:x123@(127.0.0.1:13306)/")
 	// db, err := sql.Open("mysql", "sa:x123@(192.168.101.4:3306)/")
@@ -35,7 +130,7 @@ func CreateTables() {
 CREATE TABLE if not exists user(
 	id INT AUTO_INCREMENT,
 	username VARCHAR(50) NOT NULL,
-	password VARCHAR(60) NOT NULL,
+	password VARCHAR(255) NOT NULL, -- 编码后的密码哈希（bcrypt / argon2id）
 
 	PRIMARY KEY(id),
 	UNIQUE INDEX index_user(username)
@@ -46,6 +141,24 @@ CREATE TABLE if not exists user(
 		log_utils.Logger.Printf("exec user table failure: %v", err)
 	}
 
+	addColumnIfMissing(db, "user", "email", "VARCHAR(254) DEFAULT NULL")        // 已验证的邮箱，可用于登录和找回密码
+	addColumnIfMissing(db, "user", "pendingEmail", "VARCHAR(254) DEFAULT NULL") // 等待验证的新邮箱
+	addIndexIfMissing(db, "user", "uk_user_email", "UNIQUE INDEX uk_user_email (email)")
+	addColumnIfMissing(db, "user", "status", "TINYINT NOT NULL DEFAULT 0")           // 0正常，1暂停，2封禁
+	addColumnIfMissing(db, "user", "suspendedUntil", "DATETIME DEFAULT NULL")        // 暂停到期时间
+	addColumnIfMissing(db, "user", "statusReason", "VARCHAR(255) DEFAULT NULL")      // 暂停或封禁的原因
+	addColumnIfMissing(db, "user", "contentHidden", "TINYINT(1) NOT NULL DEFAULT 0") // 是否对外隐藏资料和文章
+	addColumnIfMissing(db, "user", "deleteAfter", "DATETIME DEFAULT NULL")           // 申请删除账号后的清除时间
+
+	// 旧库的 password 列只有 VARCHAR(60)，放不下 argon2id 编码
+	query = `
+ALTER TABLE user MODIFY password VARCHAR(255) NOT NULL;
+`
+	if _, err := db.Exec(query); err != nil {
+		log.Fatal(err)
+		log_utils.Logger.Printf("alter user table failure: %v", err)
+	}
+
 	query = `
 CREATE TABLE if not exists user_incidental(
 	uid char(9), -- 主键，主要用于被搜索，生成后不可更改
@@ -66,6 +179,228 @@ CREATE TABLE if not exists user_incidental(
 		log_utils.Logger.Printf("create user_incidental table failure: %v", err)
 	}
 
+	query = `
+CREATE TABLE if not exists user_totp(
+	id INT NOT NULL, -- 外键，user.id
+	secret VARCHAR(64) NOT NULL, -- base32 编码的 TOTP 密钥
+	enabled TINYINT(1) NOT NULL DEFAULT 0, -- 0待确认，1已启用
+	createdAt DATETIME NOT NULL,
+
+	PRIMARY KEY(id),
+	FOREIGN KEY (id) REFERENCES user(id)
+	 ON DELETE cascade
+	 ON UPDATE cascade
+);
+`
+	if _, err := db.Exec(query); err != nil {
+		log.Fatal(err)
+		log_utils.Logger.Printf("create user_totp table failure: %v", err)
+	}
+
+	query = `
+CREATE TABLE if not exists user_recovery_code(
+	codeId INT AUTO_INCREMENT,
+	id INT NOT NULL, -- 外键，user.id
+	codeHash CHAR(64) NOT NULL, -- 恢复码的 SHA-256，明文只在生成时展示一次
+	usedAt DATETIME, -- 使用时间，NULL 表示未使用
+
+	PRIMARY KEY(codeId),
+	INDEX index_recovery_code(id, codeHash),
+	FOREIGN KEY (id) REFERENCES user(id)
+	 ON DELETE cascade
+	 ON UPDATE cascade
+);
+`
+	if _, err := db.Exec(query); err != nil {
+		log.Fatal(err)
+		log_utils.Logger.Printf("create user_recovery_code table failure: %v", err)
+	}
+
+	query = `
+CREATE TABLE if not exists webauthn_credential(
+	credentialId VARCHAR(255) NOT NULL, -- base64url 编码的凭证 ID
+	id INT NOT NULL, -- 外键，user.id
+	name VARCHAR(100) NOT NULL DEFAULT '', -- 用户给通行密钥起的名字
+	credential TEXT NOT NULL, -- 公钥等凭证信息（JSON）
+	signCount INT UNSIGNED NOT NULL DEFAULT 0, -- 签名计数器，用于发现克隆的认证器
+	createdAt DATETIME NOT NULL,
+	lastUsedAt DATETIME,
+
+	PRIMARY KEY(credentialId),
+	INDEX index_webauthn_credential(id),
+	FOREIGN KEY (id) REFERENCES user(id)
+	 ON DELETE cascade
+	 ON UPDATE cascade
+);
+`
+	if _, err := db.Exec(query); err != nil {
+		log.Fatal(err)
+		log_utils.Logger.Printf("create webauthn_credential table failure: %v", err)
+	}
+
+	query = `
+CREATE TABLE if not exists role(
+	roleId INT AUTO_INCREMENT,
+	name VARCHAR(32) NOT NULL, -- admin / editor / author
+
+	PRIMARY KEY(roleId),
+	UNIQUE INDEX index_role(name)
+);
+`
+	if _, err := db.Exec(query); err != nil {
+		log.Fatal(err)
+		log_utils.Logger.Printf("create role table failure: %v", err)
+	}
+
+	query = `
+CREATE TABLE if not exists permission(
+	permissionId INT AUTO_INCREMENT,
+	name VARCHAR(64) NOT NULL, -- 形如 article:write
+
+	PRIMARY KEY(permissionId),
+	UNIQUE INDEX index_permission(name)
+);
+`
+	if _, err := db.Exec(query); err != nil {
+		log.Fatal(err)
+		log_utils.Logger.Printf("create permission table failure: %v", err)
+	}
+
+	query = `
+CREATE TABLE if not exists role_permission(
+	roleId INT NOT NULL,
+	permissionId INT NOT NULL,
+
+	PRIMARY KEY(roleId, permissionId),
+	FOREIGN KEY (roleId) REFERENCES role(roleId)
+	 ON DELETE cascade
+	 ON UPDATE cascade,
+	FOREIGN KEY (permissionId) REFERENCES permission(permissionId)
+	 ON DELETE cascade
+	 ON UPDATE cascade
+);
+`
+	if _, err := db.Exec(query); err != nil {
+		log.Fatal(err)
+		log_utils.Logger.Printf("create role_permission table failure: %v", err)
+	}
+
+	query = `
+CREATE TABLE if not exists user_role(
+	id INT NOT NULL, -- 外键，user.id
+	roleId INT NOT NULL,
+	grantedBy char(9), -- 授予者的 uid，NULL 表示系统授予
+	grantedAt DATETIME NOT NULL,
+
+	PRIMARY KEY(id, roleId),
+	FOREIGN KEY (id) REFERENCES user(id)
+	 ON DELETE cascade
+	 ON UPDATE cascade,
+	FOREIGN KEY (roleId) REFERENCES role(roleId)
+	 ON DELETE cascade
+	 ON UPDATE cascade
+);
+`
+	if _, err := db.Exec(query); err != nil {
+		log.Fatal(err)
+		log_utils.Logger.Printf("create user_role table failure: %v", err)
+	}
+
+	seedRoles(db)
+
+	query = `
+CREATE TABLE if not exists personal_access_token(
+	tokenId char(16) NOT NULL, -- 对外展示的令牌 ID
+	id INT NOT NULL, -- 外键，user.id
+	name VARCHAR(100) NOT NULL, -- 用户给令牌起的名字
+	tokenHash CHAR(64) NOT NULL, -- 令牌的 SHA-256，明文只在创建时展示一次
+	scopes VARCHAR(500) NOT NULL, -- 逗号分隔的权限
+	createdAt DATETIME NOT NULL,
+	expiresAt DATETIME NOT NULL,
+	lastUsedAt DATETIME,
+
+	PRIMARY KEY(tokenId),
+	UNIQUE INDEX index_access_token_hash(tokenHash),
+	INDEX index_access_token_user(id),
+	FOREIGN KEY (id) REFERENCES user(id)
+	 ON DELETE cascade
+	 ON UPDATE cascade
+);
+`
+	if _, err := db.Exec(query); err != nil {
+		log.Fatal(err)
+		log_utils.Logger.Printf("create personal_access_token table failure: %v", err)
+	}
+
+	query = `
+CREATE TABLE if not exists user_media(
+	objectName VARCHAR(512) NOT NULL, -- OSS 对象名
+	id INT NOT NULL, -- 外键，user.id
+	kind VARCHAR(32) NOT NULL, -- 上传用途，如 profile
+	createdAt DATETIME NOT NULL,
+
+	PRIMARY KEY(objectName),
+	INDEX index_user_media(id),
+	FOREIGN KEY (id) REFERENCES user(id)
+	 ON DELETE cascade
+	 ON UPDATE cascade
+);
+`
+	if _, err := db.Exec(query); err != nil {
+		log.Fatal(err)
+		log_utils.Logger.Printf("create user_media table failure: %v", err)
+	}
+
+	query = `
+CREATE TABLE if not exists sign_in_location(
+	locationId BIGINT AUTO_INCREMENT,
+	id INT NOT NULL, -- 外键，user.id
+	ip VARCHAR(45) NOT NULL,
+	country VARCHAR(8) NOT NULL DEFAULT '',
+	region VARCHAR(128) NOT NULL DEFAULT '',
+	city VARCHAR(128) NOT NULL DEFAULT '',
+	asn VARCHAR(16) NOT NULL DEFAULT '', -- 自治系统编号
+	latitude DOUBLE,
+	longitude DOUBLE,
+	createdAt DATETIME NOT NULL,
+
+	PRIMARY KEY(locationId),
+	INDEX index_sign_in_location(id, createdAt),
+	FOREIGN KEY (id) REFERENCES user(id)
+	 ON DELETE cascade
+	 ON UPDATE cascade
+);
+`
+	if _, err := db.Exec(query); err != nil {
+		log.Fatal(err)
+		log_utils.Logger.Printf("create sign_in_location table failure: %v", err)
+	}
+
+	// 审计日志只追加不修改；不设外键，删除账号后记录仍然保留
+	query = `
+CREATE TABLE if not exists audit_event(
+	eventId BIGINT AUTO_INCREMENT,
+	actorUid char(9), -- 执行操作的用户，匿名操作为 NULL
+	action VARCHAR(64) NOT NULL,
+	targetUid char(9), -- 被操作的用户
+	target VARCHAR(255) NOT NULL DEFAULT '', -- 其他操作对象，如用户名、会话 ID、角色名
+	ip VARCHAR(45) NOT NULL DEFAULT '',
+	userAgent VARCHAR(512) NOT NULL DEFAULT '',
+	beforeValue TEXT, -- 修改前的值
+	afterValue TEXT, -- 修改后的值
+	createdAt DATETIME NOT NULL,
+
+	PRIMARY KEY(eventId),
+	INDEX index_audit_actor(actorUid, eventId),
+	INDEX index_audit_target(targetUid, eventId),
+	INDEX index_audit_action(action, eventId)
+);
+`
+	if _, err := db.Exec(query); err != nil {
+		log.Fatal(err)
+		log_utils.Logger.Printf("create audit_event table failure: %v", err)
+	}
+
 	query = `
 CREATE TABLE if not exists article(
 	uuid char(16), -- 主键，唯一搜索
@@ -93,6 +428,88 @@ CREATE TABLE if not exists article(
 		log.Fatal(err)
 		log_utils.Logger.Printf("create article table failure: %v", err)
 	}
+	addIndexIfMissing(db, "article", "index_article_uid", "INDEX index_article_uid (uid, createdAt)")
+	addColumnIfMissing(db, "article", "publishedAt", "DATETIME DEFAULT NULL") // 首次发布时间，与 updatedAt 分开
+	addColumnIfMissing(db, "article", "scheduledAt", "DATETIME DEFAULT NULL") // 定时发布时间，只对草稿有效
+	addIndexIfMissing(db, "article", "index_article_scheduled", "INDEX index_article_scheduled (scheduledAt)")
+	addIndexIfMissing(db, "article", "index_article_published", "INDEX index_article_published (status, publishedAt)")
+
+	// 加列之前已经发布的文章以创建时间作为发布时间
+	query = `
+	UPDATE article
+	SET publishedAt = createdAt
+	WHERE status = 1 AND publishedAt IS NULL
+	`
+	if _, err := db.Exec(query); err != nil {
+		log.Fatal(err)
+		log_utils.Logger.Printf("backfill article.publishedAt failure: %v", err)
+	}
+
+	query = `
+CREATE TABLE if not exists article_revision(
+	uuid char(16) NOT NULL, -- 外键，article.uuid
+	revision INT NOT NULL, -- 每篇文章从 1 开始递增
+	editor char(9) NOT NULL, -- 保存者的 uid，可能是管理员
+	title TINYTEXT NOT NULL,
+	summary TEXT NOT NULL,
+	content MEDIUMTEXT NOT NULL,
+	tags TEXT,
+	createdAt DATETIME NOT NULL, -- 保存时间
+	restoredFrom INT DEFAULT NULL, -- 由哪个版本恢复而来
+
+	PRIMARY KEY(uuid, revision),
+	FOREIGN KEY (uuid) REFERENCES article(uuid)
+	 ON DELETE cascade
+	 ON UPDATE cascade
+);
+`
+	if _, err := db.Exec(query); err != nil {
+		log.Fatal(err)
+		log_utils.Logger.Printf("create article_revision table failure: %v", err)
+	}
+
+	query = `
+CREATE TABLE if not exists tag(
+	tagId INT AUTO_INCREMENT,
+	slug VARCHAR(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL, -- 规范化后的标签
+	name VARCHAR(64) NOT NULL, -- 首次出现时的写法
+
+	PRIMARY KEY(tagId),
+	UNIQUE INDEX index_tag_slug(slug)
+);
+`
+	if _, err := db.Exec(query); err != nil {
+		log.Fatal(err)
+		log_utils.Logger.Printf("create tag table failure: %v", err)
+	}
+
+	query = `
+CREATE TABLE if not exists article_tag(
+	uuid char(16) NOT NULL, -- 外键，article.uuid
+	tagId INT NOT NULL, -- 外键，tag.tagId
+
+	PRIMARY KEY(uuid, tagId),
+	INDEX index_article_tag_tag(tagId, uuid),
+	FOREIGN KEY (uuid) REFERENCES article(uuid)
+	 ON DELETE cascade
+	 ON UPDATE cascade,
+	FOREIGN KEY (tagId) REFERENCES tag(tagId)
+	 ON DELETE cascade
+	 ON UPDATE cascade
+);
+`
+	if _, err := db.Exec(query); err != nil {
+		log.Fatal(err)
+		log_utils.Logger.Printf("create article_tag table failure: %v", err)
+	}
+
+	// 把旧的 article.tags 文本解析进标签表
+	if migrated, err := article_utils.MigrateTags(db); err != nil {
+		log.Fatal(err)
+		log_utils.Logger.Printf("migrate article tags failure: %v", err)
+	} else if migrated > 0 {
+		log_utils.Logger.Printf("migrated tags of %d articles", migrated)
+	}
 	/*
 		query = `
 		CREATE VIEW if not exists view_user AS
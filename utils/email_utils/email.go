@@ -0,0 +1,148 @@
+package email_utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/yux77yux/blog-backend/internal/model"
+	"github.com/yux77yux/blog-backend/utils/mail_utils"
+	"github.com/yux77yux/blog-backend/utils/redis_utils"
+	"github.com/yux77yux/blog-backend/utils/user_utils"
+)
+
+const (
+	// 验证链接的有效期
+	verifyTokenTTL = time.Hour * 24
+	// 同一用户两次发送验证邮件的最短间隔
+	VerifyThrottle = time.Minute
+)
+
+var (
+	ErrVerifyTokenInvalid = errors.New("email verification link is invalid or expired")
+	ErrVerifyThrottled    = errors.New("a verification email was sent recently, try again later")
+)
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// SendVerification 给待验证的邮箱发送验证链接，发送过于频繁时返回 ErrVerifyThrottled
+func SendVerification(uid string, email string) error {
+	ok, err := redis_utils.AcquireThrottle(fmt.Sprintf("email_verify:%s", uid), VerifyThrottle)
+	if err != nil {
+		return fmt.Errorf("email_utils SendVerification: %v", err)
+	}
+	if !ok {
+		return ErrVerifyThrottled
+	}
+
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return fmt.Errorf("email_utils SendVerification rand.Read: %v", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(bytes)
+
+	// 令牌绑定具体地址，之后改过邮箱的旧链接会失效
+	value := fmt.Sprintf("%s|%s", uid, email)
+	if err := redis_utils.StoreOneTimeToken("email_verify", hashToken(token), value, verifyTokenTTL); err != nil {
+		return fmt.Errorf("email_utils SendVerification: %v", err)
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", mail_utils.PublicURL, url.QueryEscape(token))
+	err = mail_utils.Send(mail_utils.Message{
+		To:      email,
+		Subject: "验证邮箱",
+		Body: fmt.Sprintf("你好：\n\n请在 %d 小时内打开以下链接完成邮箱验证：\n%s\n\n如果不是你本人操作，请忽略这封邮件。\n",
+			int(verifyTokenTTL.Hours()), link),
+	})
+	if err != nil {
+		return fmt.Errorf("email_utils SendVerification: %v", err)
+	}
+	return nil
+}
+
+// ConfirmVerification 消耗验证令牌并把对应的邮箱标记为已验证，返回 uid
+func ConfirmVerification(token string) (string, error) {
+	value, err := redis_utils.TakeOneTimeToken("email_verify", hashToken(token))
+	if err == redis.Nil {
+		return "", ErrVerifyTokenInvalid
+	}
+	if err != nil {
+		return "", fmt.Errorf("email_utils ConfirmVerification: %v", err)
+	}
+
+	uid, email, found := strings.Cut(value, "|")
+	if !found {
+		return "", ErrVerifyTokenInvalid
+	}
+
+	if err := user_utils.ConfirmEmail(uid, email); err != nil {
+		if errors.Is(err, user_utils.ErrEmailChanged) {
+			return "", ErrVerifyTokenInvalid
+		}
+		return "", fmt.Errorf("email_utils ConfirmVerification: %w", err)
+	}
+	return uid, nil
+}
+
+// NotifyEmailChange 通知旧邮箱有人申请更换绑定地址
+func NotifyEmailChange(oldEmail string, newEmail string) error {
+	err := mail_utils.Send(mail_utils.Message{
+		To:      oldEmail,
+		Subject: "邮箱变更提醒",
+		Body: fmt.Sprintf("你好：\n\n你的账号申请将邮箱更换为 %s，新邮箱验证通过后生效。\n\n如果不是你本人操作，请尽快修改密码。\n",
+			newEmail),
+	})
+	if err != nil {
+		return fmt.Errorf("email_utils NotifyEmailChange: %v", err)
+	}
+	return nil
+}
+
+// NotifySuspiciousSignIn 提醒用户账号在陌生位置登录
+func NotifySuspiciousSignIn(email string, location *model.SignInLocation) error {
+	place := strings.Join(nonEmpty(location.City, location.Region, location.Country), ", ")
+	err := mail_utils.Send(mail_utils.Message{
+		To:      email,
+		Subject: "异地登录提醒",
+		Body: fmt.Sprintf("你好：\n\n你的账号于 %s 在新的位置登录：\n位置：%s\nIP：%s\n\n如果不是你本人操作，请立即修改密码并在账号设置中撤销其他会话。\n",
+			time.Now().Format("2006-01-02 15:04:05"), place, location.IP),
+	})
+	if err != nil {
+		return fmt.Errorf("email_utils NotifySuspiciousSignIn: %v", err)
+	}
+	return nil
+}
+
+// SendStepUpCode 发送异地登录的邮件验证码
+func SendStepUpCode(email string, code string, ttl time.Duration) error {
+	err := mail_utils.Send(mail_utils.Message{
+		To:      email,
+		Subject: "登录验证码",
+		Body: fmt.Sprintf("你好：\n\n检测到来自新位置的登录，验证码为：%s\n验证码 %d 分钟内有效。\n\n如果不是你本人操作，请立即修改密码。\n",
+			code, int(ttl.Minutes())),
+	})
+	if err != nil {
+		return fmt.Errorf("email_utils SendStepUpCode: %v", err)
+	}
+	return nil
+}
+
+func nonEmpty(values ...string) []string {
+	result := []string{}
+	for _, value := range values {
+		if value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
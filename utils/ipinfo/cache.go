@@ -0,0 +1,135 @@
+package ipinfo
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+	"github.com/yux77yux/blog-backend/utils/redis_utils"
+)
+
+// 查不到的地址只在进程内缓存这么久，避免反复查询
+const notFoundTTL = time.Minute * 10
+
+// CachedResolver 在 Next 前面加一层进程内 LRU，Shared 为 true 时再用 Redis 作为共享的二级缓存
+type CachedResolver struct {
+	Next   GeoResolver
+	TTL    time.Duration
+	Shared bool
+
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type cacheEntry struct {
+	ip      string
+	info    *IPInfo // nil 表示查不到
+	expires time.Time
+}
+
+func NewCachedResolver(next GeoResolver, size int, ttl time.Duration, shared bool) *CachedResolver {
+	if size < 1 {
+		size = 1
+	}
+	return &CachedResolver{
+		Next:    next,
+		TTL:     ttl,
+		Shared:  shared,
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (cache *CachedResolver) get(ip string) (*cacheEntry, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	element, ok := cache.entries[ip]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		cache.order.Remove(element)
+		delete(cache.entries, ip)
+		return nil, false
+	}
+	cache.order.MoveToFront(element)
+	return entry, true
+}
+
+func (cache *CachedResolver) put(ip string, info *IPInfo, ttl time.Duration) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	entry := &cacheEntry{ip: ip, info: info, expires: time.Now().Add(ttl)}
+	if element, ok := cache.entries[ip]; ok {
+		element.Value = entry
+		cache.order.MoveToFront(element)
+		return
+	}
+
+	cache.entries[ip] = cache.order.PushFront(entry)
+	for cache.order.Len() > cache.size {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.entries, oldest.Value.(*cacheEntry).ip)
+	}
+}
+
+// 返回副本，调用方修改结果不会影响缓存
+func copyInfo(info *IPInfo) *IPInfo {
+	copied := *info
+	return &copied
+}
+
+func (cache *CachedResolver) Resolve(ip net.IP) (*IPInfo, error) {
+	key := ip.String()
+
+	if entry, ok := cache.get(key); ok {
+		if entry.info == nil {
+			return nil, ErrNotFound
+		}
+		return copyInfo(entry.info), nil
+	}
+
+	if cache.Shared {
+		data, err := redis_utils.GetGeoCache(key)
+		if err == nil {
+			var info IPInfo
+			if err := json.Unmarshal([]byte(data), &info); err == nil {
+				cache.put(key, &info, cache.TTL)
+				return copyInfo(&info), nil
+			}
+		} else if err != redis.Nil {
+			log_utils.Logger.Printf("Error: ipinfo CachedResolver GetGeoCache: %v", err)
+		}
+	}
+
+	info, err := cache.Next.Resolve(ip)
+	if errors.Is(err, ErrNotFound) {
+		cache.put(key, nil, notFoundTTL)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cache.put(key, info, cache.TTL)
+	if cache.Shared {
+		if data, err := json.Marshal(info); err == nil {
+			if err := redis_utils.StoreGeoCache(key, string(data), cache.TTL); err != nil {
+				log_utils.Logger.Printf("Error: ipinfo CachedResolver StoreGeoCache: %v", err)
+			}
+		}
+	}
+	return copyInfo(info), nil
+}
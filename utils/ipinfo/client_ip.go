@@ -0,0 +1,156 @@
+package ipinfo
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+)
+
+type contextKey string
+
+const clientIPKey contextKey = "clientIP"
+
+// 可信的反向代理，只有来自这些地址的请求才读取转发头；
+// 通过 BLOG_TRUSTED_PROXIES 配置，逗号分隔的 CIDR 或单个 IP，默认只信任本机
+var TrustedProxies = loadTrustedProxies()
+
+func loadTrustedProxies() []*net.IPNet {
+	list := getEnv("BLOG_TRUSTED_PROXIES", "127.0.0.0/8,::1/128")
+	proxies, invalid := ParseTrustedProxies(list)
+	for _, value := range invalid {
+		log_utils.Logger.Printf("Error: ipinfo BLOG_TRUSTED_PROXIES invalid entry: %q", value)
+	}
+	return proxies
+}
+
+// ParseTrustedProxies 解析逗号分隔的 CIDR 或 IP，返回无法解析的条目
+func ParseTrustedProxies(list string) ([]*net.IPNet, []string) {
+	proxies := []*net.IPNet{}
+	invalid := []string{}
+	for _, value := range strings.Split(list, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				invalid = append(invalid, value)
+				continue
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			invalid = append(invalid, value)
+			continue
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, invalid
+}
+
+func isTrusted(ip net.IP, proxies []*net.IPNet) bool {
+	for _, network := range proxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHost 去掉端口、方括号和引号，如 "[2001:db8::1]:4711"、1.2.3.4:80
+func parseHost(value string) net.IP {
+	value = strings.Trim(strings.TrimSpace(value), `"`)
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+	return net.ParseIP(value)
+}
+
+// forwardedFor 取出 RFC 7239 Forwarded 头中的全部 for= 值，按出现顺序
+func forwardedFor(headers []string) []string {
+	values := []string{}
+	for _, header := range headers {
+		for _, element := range strings.Split(header, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if found && strings.EqualFold(key, "for") {
+					values = append(values, value)
+				}
+			}
+		}
+	}
+	return values
+}
+
+// forwardedXFF 取出 X-Forwarded-For 中的全部地址，多个头按顺序拼接
+func forwardedXFF(headers []string) []string {
+	values := []string{}
+	for _, header := range headers {
+		for _, value := range strings.Split(header, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+// ResolveClientIP 从 RemoteAddr 开始从右往左跳过可信代理，第一个不可信的地址即客户端；
+// 转发链中出现无法解析的值时停止，返回最后一个可信的地址
+func ResolveClientIP(r *http.Request, proxies []*net.IPNet) string {
+	remote := parseHost(r.RemoteAddr)
+	if remote == nil {
+		return r.RemoteAddr
+	}
+	if !isTrusted(remote, proxies) {
+		return remote.String()
+	}
+
+	// 同时存在时以标准的 Forwarded 为准
+	var chain []string
+	if headers := r.Header.Values("Forwarded"); len(headers) > 0 {
+		chain = forwardedFor(headers)
+	} else if headers := r.Header.Values("X-Forwarded-For"); len(headers) > 0 {
+		chain = forwardedXFF(headers)
+	} else if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+		chain = []string{realIP}
+	}
+
+	client := remote
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := parseHost(chain[i])
+		if ip == nil {
+			break
+		}
+		client = ip
+		if !isTrusted(ip, proxies) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// WithClientIP 解析一次客户端 IP 并放入请求上下文
+func WithClientIP(r *http.Request) *http.Request {
+	ip := ResolveClientIP(r, TrustedProxies)
+	return r.WithContext(context.WithValue(r.Context(), clientIPKey, ip))
+}
+
+// GetClientIP 优先使用中间件解析好的结果，限流、审计和会话都通过它取 IP
+func GetClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey).(string); ok {
+		return ip
+	}
+	return ResolveClientIP(r, TrustedProxies)
+}
@@ -0,0 +1,103 @@
+package ipinfo
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+)
+
+var (
+	ErrNotFound     = errors.New("ip location not found")
+	ErrInvalidIP    = errors.New("invalid ip address")
+	ErrNoGeoBackend = errors.New("no geolocation backend configured")
+)
+
+// GeoResolver 把 IP 解析为地理位置，查不到时返回 ErrNotFound
+type GeoResolver interface {
+	Resolve(ip net.IP) (*IPInfo, error)
+}
+
+// FallbackResolver 依次尝试，前一个失败时交给下一个
+type FallbackResolver []GeoResolver
+
+func (resolvers FallbackResolver) Resolve(ip net.IP) (*IPInfo, error) {
+	err := ErrNoGeoBackend
+	for _, resolver := range resolvers {
+		var info *IPInfo
+		info, err = resolver.Resolve(ip)
+		if err == nil {
+			return info, nil
+		}
+	}
+	return nil, err
+}
+
+// 默认解析器：配置了 mmdb 时离线查询，HTTP 只作为可选的兜底
+var Default GeoResolver = newDefaultResolver()
+
+func getEnv(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func newDefaultResolver() GeoResolver {
+	resolvers := FallbackResolver{}
+
+	if path := os.Getenv("BLOG_GEOIP_CITY_DB"); path != "" {
+		resolver, err := OpenMMDB(path, os.Getenv("BLOG_GEOIP_ASN_DB"))
+		if err != nil {
+			log_utils.Logger.Printf("Error: ipinfo OpenMMDB: %v", err)
+		} else {
+			resolvers = append(resolvers, resolver)
+		}
+	}
+
+	// BLOG_GEOIP_HTTP=1 或配置了 token 时启用 ipinfo.io 兜底
+	token := os.Getenv("BLOG_IPINFO_TOKEN")
+	if token != "" || os.Getenv("BLOG_GEOIP_HTTP") != "" {
+		resolvers = append(resolvers, NewHTTPResolver(token))
+	}
+
+	size, err := strconv.Atoi(getEnv("BLOG_GEOIP_CACHE_SIZE", "4096"))
+	if err != nil {
+		log_utils.Logger.Printf("Error: ipinfo BLOG_GEOIP_CACHE_SIZE is not a number: %v", err)
+		size = 4096
+	}
+	return NewCachedResolver(resolvers, size, time.Hour*24, true)
+}
+
+// 内网、回环等地址没有地理位置
+func isPublic(ip net.IP) bool {
+	return !(ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsMulticast())
+}
+
+// GetIPInfo 通过 Default 查询 IP 的地理位置，非公网地址只返回 IP
+func GetIPInfo(ip string) (*IPInfo, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		// 兼容带端口的地址
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip, parsed = host, net.ParseIP(host)
+		}
+	}
+	if parsed == nil {
+		return nil, fmt.Errorf("ipinfo GetIPInfo %q: %w", ip, ErrInvalidIP)
+	}
+	if !isPublic(parsed) {
+		return &IPInfo{IP: ip}, nil
+	}
+
+	info, err := Default.Resolve(parsed)
+	if err != nil {
+		return nil, fmt.Errorf("ipinfo GetIPInfo: %w", err)
+	}
+	return info, nil
+}
@@ -0,0 +1,62 @@
+package ipinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const ipinfoURL = "https://ipinfo.io/"
+
+// HTTPResolver 调用 ipinfo.io，需要联网，只作兜底
+type HTTPResolver struct {
+	BaseURL string
+	Token   string
+	Client  *http.Client
+}
+
+func NewHTTPResolver(token string) *HTTPResolver {
+	return &HTTPResolver{
+		BaseURL: ipinfoURL,
+		Token:   token,
+		Client:  &http.Client{Timeout: time.Second * 3},
+	}
+}
+
+func (resolver *HTTPResolver) Resolve(ip net.IP) (*IPInfo, error) {
+	endpoint := resolver.BaseURL + url.PathEscape(ip.String()) + "/json"
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ipinfo HTTPResolver NewRequest: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	// token 放在请求头里，避免随 URL 出现在错误信息和日志中
+	if resolver.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+resolver.Token)
+	}
+
+	resp, err := resolver.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ipinfo HTTPResolver Do: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ipinfo HTTPResolver: unexpected status %d", resp.StatusCode)
+	}
+
+	var info IPInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("ipinfo HTTPResolver Decode: %v", err)
+	}
+	if info.Country == "" {
+		return nil, ErrNotFound
+	}
+	return &info, nil
+}
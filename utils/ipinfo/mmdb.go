@@ -0,0 +1,100 @@
+package ipinfo
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// MMDBResolver 读取本地 MaxMind 格式的数据库（GeoLite2-City / GeoLite2-ASN），不需要联网
+type MMDBResolver struct {
+	City *maxminddb.Reader
+	// 可选，没有时 Org 为空
+	ASN *maxminddb.Reader
+}
+
+type mmdbCity struct {
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	Location struct {
+		Latitude  *float64 `maxminddb:"latitude"`
+		Longitude *float64 `maxminddb:"longitude"`
+		TimeZone  string   `maxminddb:"time_zone"`
+	} `maxminddb:"location"`
+}
+
+type mmdbASN struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+func OpenMMDB(cityPath string, asnPath string) (*MMDBResolver, error) {
+	city, err := maxminddb.Open(cityPath)
+	if err != nil {
+		return nil, fmt.Errorf("ipinfo OpenMMDB %s: %v", cityPath, err)
+	}
+
+	resolver := &MMDBResolver{City: city}
+	if asnPath != "" {
+		resolver.ASN, err = maxminddb.Open(asnPath)
+		if err != nil {
+			city.Close()
+			return nil, fmt.Errorf("ipinfo OpenMMDB %s: %v", asnPath, err)
+		}
+	}
+	return resolver, nil
+}
+
+func (resolver *MMDBResolver) Resolve(ip net.IP) (*IPInfo, error) {
+	var record mmdbCity
+	_, found, err := resolver.City.LookupNetwork(ip, &record)
+	if err != nil {
+		return nil, fmt.Errorf("ipinfo MMDBResolver LookupNetwork: %v", err)
+	}
+	if !found || record.Country.ISOCode == "" {
+		return nil, ErrNotFound
+	}
+
+	info := &IPInfo{
+		IP:       ip.String(),
+		City:     record.City.Names["en"],
+		Country:  record.Country.ISOCode,
+		Timezone: record.Location.TimeZone,
+	}
+	if len(record.Subdivisions) > 0 {
+		info.Region = record.Subdivisions[0].Names["en"]
+	}
+	if record.Location.Latitude != nil && record.Location.Longitude != nil {
+		// 与 ipinfo.io 的 loc 字段保持同一格式
+		info.Location = strconv.FormatFloat(*record.Location.Latitude, 'f', 4, 64) + "," +
+			strconv.FormatFloat(*record.Location.Longitude, 'f', 4, 64)
+	}
+
+	if resolver.ASN != nil {
+		var asn mmdbASN
+		if err := resolver.ASN.Lookup(ip, &asn); err != nil {
+			return nil, fmt.Errorf("ipinfo MMDBResolver Lookup: %v", err)
+		}
+		if asn.Number != 0 {
+			info.Org = fmt.Sprintf("AS%d %s", asn.Number, asn.Organization)
+		}
+	}
+
+	return info, nil
+}
+
+func (resolver *MMDBResolver) Close() error {
+	if resolver.ASN != nil {
+		resolver.ASN.Close()
+	}
+	return resolver.City.Close()
+}
@@ -1,14 +1,13 @@
 package ipinfo
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
-const ipinfoURL = "https://ipinfo.io/"
-
 type IPInfo struct {
 	IP       string `json:"ip"`
 	City     string `json:"city"`
@@ -16,6 +15,33 @@ type IPInfo struct {
 	Country  string `json:"country"`
 	Location string `json:"loc"`
 	Timezone string `json:"timezone"`
+	Org      string `json:"org"`
+}
+
+// ASN 从 org 字段中取出自治系统编号，如 "AS15169 Google LLC" 返回 "AS15169"
+func (info *IPInfo) ASN() string {
+	asn, _, _ := strings.Cut(info.Org, " ")
+	if !strings.HasPrefix(asn, "AS") {
+		return ""
+	}
+	return asn
+}
+
+// Coordinates 解析 loc 字段中的经纬度
+func (info *IPInfo) Coordinates() (float64, float64, bool) {
+	latitude, longitude, found := strings.Cut(info.Location, ",")
+	if !found {
+		return 0, 0, false
+	}
+	lat, err := strconv.ParseFloat(latitude, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	lon, err := strconv.ParseFloat(longitude, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return lat, lon, true
 }
 
 func TransfromTime(r *http.Request, timezone string) string {
@@ -32,32 +58,3 @@ func TransfromTime(r *http.Request, timezone string) string {
 
 	return mysqlDatetime
 }
-
-func GetIPInfo(ip string) (*IPInfo, error) {
-	resp, err := http.Get(fmt.Sprintf("%s%s?token=c60e5a7e2bb42d", ipinfoURL, ip))
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	var info IPInfo
-	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
-		return nil, err
-	}
-
-	return &info, nil
-}
-
-func GetClientIP(r *http.Request) string {
-	// 尝试从 X-Forwarded-For 中获取
-	ip := r.Header.Get("X-Forwarded-For")
-	if ip == "" {
-		// 尝试从 X-Real-IP 中获取
-		ip = r.Header.Get("X-Real-IP")
-	}
-	if ip == "" {
-		// 默认从 RemoteAddr 获取
-		ip = r.RemoteAddr
-	}
-	return ip
-}
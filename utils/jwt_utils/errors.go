@@ -0,0 +1,40 @@
+package jwt_utils
+
+import (
+	"errors"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// ParseJWT 返回的错误都包裹了以下之一，调用方用 errors.Is 区分
+var (
+	ErrTokenExpired   = errors.New("token is expired")
+	ErrTokenRevoked   = errors.New("token has been revoked")
+	ErrTokenMalformed = errors.New("token is malformed")
+	ErrTokenSignature = errors.New("token signature is invalid")
+	// 账号被暂停或封禁
+	ErrAccountDisabled = errors.New("account is suspended or banned")
+)
+
+// RotateRefreshToken 返回的错误
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+	ErrRefreshTokenReused  = errors.New("refresh token has already been used")
+)
+
+func classifyError(err error) error {
+	var validationErr *jwt.ValidationError
+	if !errors.As(err, &validationErr) {
+		return ErrTokenMalformed
+	}
+
+	switch {
+	case validationErr.Errors&jwt.ValidationErrorMalformed != 0:
+		return ErrTokenMalformed
+	case validationErr.Errors&jwt.ValidationErrorExpired != 0:
+		return ErrTokenExpired
+	case validationErr.Errors&(jwt.ValidationErrorSignatureInvalid|jwt.ValidationErrorUnverifiable) != 0:
+		return ErrTokenSignature
+	}
+	return ErrTokenMalformed
+}
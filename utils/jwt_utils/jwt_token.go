@@ -3,6 +3,7 @@ package jwt_utils
 import (
 	"crypto/rand"
 	"fmt"
+	"math"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -10,11 +11,15 @@ import (
 	"github.com/yux77yux/blog-backend/utils/redis_utils"
 )
 
-func GenerateJWT(uid string) (string, error) {
+// access token 有效期，过期后用 refresh token 换取新的
+const AccessTokenTTL = time.Minute * 15
+
+// sid 为会话 ID（即 refresh token 家族），撤销会话后该会话的 token 立即失效；
+// roles 和 permissions 写入 claims，供 RequirePermission 直接判断
+func GenerateJWT(uid string, sid string, roles []string, permissions []string) (string, error) {
 	var timeatamp int64
 	const maxRetries = 8
 	const length = 32
-	signingKey := make([]byte, length)
 	bytes := make([]byte, length)
 	_, err := rand.Read(bytes)
 	if err != nil {
@@ -44,41 +49,29 @@ func GenerateJWT(uid string) (string, error) {
 	}
 
 	// Set claims
+	// iat 精确到毫秒，同一秒内吊销之后签发的 token 不会被误判
+	now := time.Now()
 	claims := jwt.MapClaims{
-		"sub": uid,
-		"exp": time.Now().Add(time.Hour * 48).Unix(),
-		"iat": time.Now().Unix(),
-		"jti": fmt.Sprintf("%d", timeatamp),
+		"sub":   uid,
+		"sid":   sid,
+		"exp":   now.Add(AccessTokenTTL).Unix(),
+		"iat":   float64(now.UnixMilli()) / 1000,
+		"jti":   fmt.Sprintf("%d", timeatamp),
+		"roles": roles,
+		"perms": permissions,
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	isExist, err := redis_utils.ExistsSigningKeyInRedix(uid)
+	key, err := ring.currentKey()
 	if err != nil {
-		fmt.Println("Error: GenerateJWT ExistsSigningKeyInRedix : ", err)
-		log_utils.Logger.Printf("Error: GenerateJWT ExistsSigningKeyInRedix : %v", err)
+		log_utils.Logger.Printf("Error: GenerateJWT currentKey : %v", err)
+		return "", fmt.Errorf("GenerateJWT currentKey : %v", err)
 	}
 
-	if isExist {
-		signingKey, err = redis_utils.RetrieveSigningKeyInRedis(uid)
-		if err != nil {
-			log_utils.Logger.Printf("Error: GenerateJWT RetrieveSigningKeyInRedis : %v", err)
-		}
-	} else {
-		_, err := rand.Read(signingKey)
-		if err != nil {
-			return "", fmt.Errorf("GenerateJWT rand.Read: %v", err)
-		}
-
-		go func() {
-			if err := redis_utils.StoreSigningKeyInRedis(uid, signingKey); err != nil {
-				log_utils.Logger.Printf("Error: GenerateJWT StoreSigningKeyInRedis: %v", err)
-			}
-		}()
-	}
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.Kid
 
-	// Sign the token with our secret
-	tokenString, err := token.SignedString(signingKey)
+	// Sign the token with the current server key
+	tokenString, err := token.SignedString(key.Private)
 	if err != nil {
 		log_utils.Logger.Printf("Error: GenerateJWT SignedString : %v", err)
 		return "", fmt.Errorf("GenerateJWT SignedString : %v", err)
@@ -89,63 +82,119 @@ func GenerateJWT(uid string) (string, error) {
 
 func ParseJWT(tokenString string) (*jwt.Token, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// 验证 token 的签名方法
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-
-		// 从 JWT 的 claims 中提取 UID
-		claims, ok := token.Claims.(jwt.MapClaims)
+		// 按 kid 找到签名密钥，并确认签名方法与密钥一致
+		kid, ok := token.Header["kid"].(string)
 		if !ok {
-			return nil, fmt.Errorf("invalid claims")
+			return nil, fmt.Errorf("kid header is missing or not a string")
 		}
 
-		sub, ok := claims["sub"].(string)
-		if !ok {
-			return nil, fmt.Errorf("sub claim is missing or not a string")
-		}
-
-		// 从 Redis 获取签名密钥
-		signingKey, err := redis_utils.RetrieveSigningKeyInRedis(sub)
+		key, err := ring.lookup(kid)
 		if err != nil {
 			return nil, fmt.Errorf("failed to retrieve signing key: %v", err)
 		}
 
-		return signingKey, nil
+		if token.Method.Alg() != key.method().Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		return key.Private.Public(), nil
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("ParseJWT Parse: %v", err)
+		return nil, fmt.Errorf("ParseJWT Parse: %w (%v)", classifyError(err), err)
 	}
 
 	if !token.Valid {
-		return nil, fmt.Errorf("ParseJWT Invalid token")
+		return nil, fmt.Errorf("ParseJWT Invalid token: %w", ErrTokenSignature)
 	}
 
-	// Validate the token's claims
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		// Check expiration
-		if exp, ok := claims["exp"].(float64); ok {
-			if int64(exp) < time.Now().Unix() {
-				return nil, fmt.Errorf("token is expired")
-			}
-		} else {
-			// Handle the case where "exp" is missing or not a float64
-			return nil, fmt.Errorf("missing or invalid exp claim")
-		}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("ParseJWT invalid token claims: %w", ErrTokenMalformed)
+	}
 
-		// Optionally, check JWT ID
-		if jti, ok := claims["jti"].(string); ok {
-			// Perform custom validation for jti if needed
-			_ = jti // Placeholder for actual validation
-		} else {
-			// Handle the case where "exp" is missing or not a float64
-			return nil, fmt.Errorf("missing or invalid jti claim")
-		}
+	// Check expiration
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("ParseJWT missing or invalid exp claim: %w", ErrTokenMalformed)
+	}
+	if int64(exp) < time.Now().Unix() {
+		return nil, fmt.Errorf("ParseJWT: %w", ErrTokenExpired)
+	}
 
-	} else {
-		return nil, fmt.Errorf("invalid token claims")
+	jti, ok := claims["jti"].(string)
+	if !ok {
+		return nil, fmt.Errorf("ParseJWT missing or invalid jti claim: %w", ErrTokenMalformed)
+	}
+
+	iat, ok := claims["iat"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("ParseJWT missing or invalid iat claim: %w", ErrTokenMalformed)
+	}
+
+	// 已注销的 jti
+	blacklisted, err := redis_utils.IsJtiBlacklisted(jti)
+	if err != nil {
+		return nil, fmt.Errorf("ParseJWT IsJtiBlacklisted: %v", err)
+	}
+	if blacklisted {
+		return nil, fmt.Errorf("ParseJWT jti %s: %w", jti, ErrTokenRevoked)
+	}
+
+	// 用户批量吊销了某个时间点之前签发的全部 token
+	sub, _ := claims["sub"].(string)
+	revokedBefore, err := redis_utils.GetTokensRevokedBefore(sub)
+	if err != nil {
+		return nil, fmt.Errorf("ParseJWT GetTokensRevokedBefore: %v", err)
+	}
+	if int64(math.Round(iat*1000)) < toMillis(revokedBefore) {
+		return nil, fmt.Errorf("ParseJWT issued before %d: %w", revokedBefore, ErrTokenRevoked)
+	}
+
+	// 账号被暂停或封禁
+	state, err := redis_utils.GetAccountBlocked(sub)
+	if err != nil {
+		return nil, fmt.Errorf("ParseJWT GetAccountBlocked: %v", err)
+	}
+	if state != "" {
+		return nil, fmt.Errorf("ParseJWT account %s: %w", state, ErrAccountDisabled)
+	}
+
+	// 角色变化之前签发的 token 携带的是旧权限
+	claimsChangedAt, err := redis_utils.GetClaimsChangedAt(sub)
+	if err != nil {
+		return nil, fmt.Errorf("ParseJWT GetClaimsChangedAt: %v", err)
+	}
+	if int64(math.Round(iat*1000)) < toMillis(claimsChangedAt) {
+		return nil, fmt.Errorf("ParseJWT claims changed at %d: %w", claimsChangedAt, ErrTokenRevoked)
+	}
+
+	// 会话已被撤销或过期
+	if sid, ok := claims["sid"].(string); ok {
+		exists, err := redis_utils.SessionExists(sid)
+		if err != nil {
+			return nil, fmt.Errorf("ParseJWT SessionExists: %v", err)
+		}
+		if !exists {
+			return nil, fmt.Errorf("ParseJWT session %s: %w", sid, ErrTokenRevoked)
+		}
 	}
 
 	return token, nil
 }
+
+// 旧版本以秒为单位保存签发和吊销时间，统一换算成毫秒再比较
+func toMillis(timestamp int64) int64 {
+	if timestamp < 1e11 {
+		return timestamp * 1000
+	}
+	return timestamp
+}
+
+// RevokeTokensIssuedBefore 使该用户在 t 之前签发的 access token 和 refresh token 全部失效，精确到毫秒
+func RevokeTokensIssuedBefore(uid string, t time.Time) error {
+	if err := redis_utils.SetTokensRevokedBefore(uid, t.UnixMilli(), RefreshTokenTTL); err != nil {
+		return fmt.Errorf("RevokeTokensIssuedBefore: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,421 @@
+package jwt_utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+	"github.com/yux77yux/blog-backend/utils/redis_utils"
+)
+
+// 新签名密钥使用的算法，"EdDSA"（Ed25519）或 "RS256"
+var SigningAlgorithm = "EdDSA"
+
+const (
+	// 当前签名密钥的使用时长
+	KeyRotationInterval = time.Hour * 24 * 7
+	// 密钥退役后仍保留用于验签的时长，需覆盖 access token 的有效期
+	KeyOverlapWindow = time.Hour * 24
+	// 进程内密钥缓存的刷新间隔
+	keyCacheTTL = time.Minute
+	// 遇到未知 kid 时两次强制刷新的最短间隔，避免伪造的 kid 让每个请求都去读 Redis
+	minReloadInterval = time.Second * 5
+)
+
+type signingKey struct {
+	Kid       string
+	Alg       string
+	Private   crypto.Signer
+	CreatedAt time.Time
+	// 被新密钥取代的时间，零值表示仍是当前密钥
+	RetiredAt time.Time
+}
+
+// Redis 中保存的密钥格式
+type storedKey struct {
+	Alg       string `json:"alg"`
+	Key       string `json:"key"` // base64 编码的 PKCS#8 私钥
+	CreatedAt int64  `json:"createdAt"`
+	RetiredAt int64  `json:"retiredAt"`
+}
+
+type keyring struct {
+	mu       sync.RWMutex
+	current  string
+	keys     map[string]*signingKey
+	loadedAt time.Time
+	// 同一时间只有一个请求因为缓存过期或未知 kid 去刷新
+	reloadMu sync.Mutex
+}
+
+var ring = &keyring{keys: map[string]*signingKey{}}
+
+func (k *signingKey) method() jwt.SigningMethod {
+	if k.Alg == "RS256" {
+		return jwt.SigningMethodRS256
+	}
+	return jwt.SigningMethodEdDSA
+}
+
+func newSigningKey(alg string) (*signingKey, error) {
+	var private crypto.Signer
+	switch alg {
+	case "EdDSA":
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		private = key
+	case "RS256":
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		private = key
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", alg)
+	}
+
+	kid, err := randomString(12)
+	if err != nil {
+		return nil, err
+	}
+
+	return &signingKey{
+		Kid:       kid,
+		Alg:       alg,
+		Private:   private,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+func encodeKey(key *signingKey) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key.Private)
+	if err != nil {
+		return "", err
+	}
+
+	stored := storedKey{
+		Alg:       key.Alg,
+		Key:       base64.StdEncoding.EncodeToString(der),
+		CreatedAt: key.CreatedAt.Unix(),
+	}
+	if !key.RetiredAt.IsZero() {
+		stored.RetiredAt = key.RetiredAt.Unix()
+	}
+
+	data, err := json.Marshal(stored)
+	return string(data), err
+}
+
+func decodeKey(kid string, data string) (*signingKey, error) {
+	var stored storedKey
+	if err := json.Unmarshal([]byte(data), &stored); err != nil {
+		return nil, err
+	}
+
+	der, err := base64.StdEncoding.DecodeString(stored.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	private, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("key %s is not a signer", kid)
+	}
+
+	key := &signingKey{
+		Kid:       kid,
+		Alg:       stored.Alg,
+		Private:   signer,
+		CreatedAt: time.Unix(stored.CreatedAt, 0),
+	}
+	if stored.RetiredAt != 0 {
+		key.RetiredAt = time.Unix(stored.RetiredAt, 0)
+	}
+	return key, nil
+}
+
+// 从 Redis 重新加载全部密钥
+func (r *keyring) load() error {
+	current, err := redis_utils.GetCurrentJwtKid()
+	if err != nil {
+		return fmt.Errorf("keyring load: %v", err)
+	}
+
+	stored, err := redis_utils.GetJwtKeys()
+	if err != nil {
+		return fmt.Errorf("keyring load: %v", err)
+	}
+
+	keys := make(map[string]*signingKey, len(stored))
+	for kid, data := range stored {
+		key, err := decodeKey(kid, data)
+		if err != nil {
+			log_utils.Logger.Printf("Error: jwt_utils keyring decodeKey %s: %v", kid, err)
+			continue
+		}
+		keys[kid] = key
+	}
+
+	r.mu.Lock()
+	r.current = current
+	r.keys = keys
+	r.loadedAt = time.Now()
+	r.mu.Unlock()
+
+	return nil
+}
+
+func (r *keyring) stale() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return time.Since(r.loadedAt) > keyCacheTTL
+}
+
+func (r *keyring) currentKey() (*signingKey, error) {
+	if r.stale() {
+		if err := r.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	r.mu.RLock()
+	key, ok := r.keys[r.current]
+	r.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	// 还没有任何密钥时现场生成一个
+	if err := RotateSigningKey(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	key, ok = r.keys[r.current]
+	if !ok {
+		return nil, fmt.Errorf("no current signing key")
+	}
+	return key, nil
+}
+
+// 按 kid 查找验签密钥，缓存里没有时强制刷新一次（其他实例可能刚轮换过）；
+// 距上次刷新不到 minReloadInterval 时直接拒绝未知 kid
+func (r *keyring) lookup(kid string) (*signingKey, error) {
+	r.mu.RLock()
+	key, ok := r.keys[kid]
+	loadedAt := r.loadedAt
+	r.mu.RUnlock()
+	if ok && time.Since(loadedAt) <= keyCacheTTL {
+		return key, nil
+	}
+	if !ok && time.Since(loadedAt) < minReloadInterval {
+		return nil, fmt.Errorf("unknown kid: %s", kid)
+	}
+
+	r.reloadMu.Lock()
+	r.mu.RLock()
+	reloaded := r.loadedAt.After(loadedAt)
+	r.mu.RUnlock()
+	// 等锁期间其他请求已经刷新过，不再重复读取
+	if !reloaded {
+		if err := r.load(); err != nil {
+			r.reloadMu.Unlock()
+			return nil, err
+		}
+	}
+	r.reloadMu.Unlock()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	key, ok = r.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid: %s", kid)
+	}
+	return key, nil
+}
+
+// RotateSigningKey 生成新的当前密钥，旧密钥标记为退役并在重叠窗口内继续用于验签
+func RotateSigningKey() error {
+	locked, err := redis_utils.AcquireJwtKeyRotationLock(time.Minute)
+	if err != nil {
+		return fmt.Errorf("RotateSigningKey: %v", err)
+	}
+	if !locked {
+		// 其他实例正在轮换，直接读取它的结果
+		return ring.load()
+	}
+	defer redis_utils.ReleaseJwtKeyRotationLock()
+
+	key, err := newSigningKey(SigningAlgorithm)
+	if err != nil {
+		return fmt.Errorf("RotateSigningKey newSigningKey: %v", err)
+	}
+
+	data, err := encodeKey(key)
+	if err != nil {
+		return fmt.Errorf("RotateSigningKey encodeKey: %v", err)
+	}
+
+	if err := redis_utils.StoreJwtKey(key.Kid, data); err != nil {
+		return fmt.Errorf("RotateSigningKey: %v", err)
+	}
+
+	previous, err := redis_utils.GetCurrentJwtKid()
+	if err != nil {
+		return fmt.Errorf("RotateSigningKey: %v", err)
+	}
+
+	if err := redis_utils.SetCurrentJwtKid(key.Kid); err != nil {
+		return fmt.Errorf("RotateSigningKey: %v", err)
+	}
+
+	if previous != "" {
+		if err := retireKey(previous); err != nil {
+			log_utils.Logger.Printf("Error: RotateSigningKey retireKey: %v", err)
+		}
+	}
+
+	return ring.load()
+}
+
+func retireKey(kid string) error {
+	stored, err := redis_utils.GetJwtKeys()
+	if err != nil {
+		return err
+	}
+
+	data, ok := stored[kid]
+	if !ok {
+		return nil
+	}
+
+	key, err := decodeKey(kid, data)
+	if err != nil {
+		return err
+	}
+
+	key.RetiredAt = time.Now()
+	data, err = encodeKey(key)
+	if err != nil {
+		return err
+	}
+
+	return redis_utils.StoreJwtKey(kid, data)
+}
+
+// 删除重叠窗口已过的退役密钥
+func removeExpiredKeys() error {
+	stored, err := redis_utils.GetJwtKeys()
+	if err != nil {
+		return err
+	}
+
+	for kid, data := range stored {
+		key, err := decodeKey(kid, data)
+		if err != nil {
+			continue
+		}
+		if !key.RetiredAt.IsZero() && time.Since(key.RetiredAt) > KeyOverlapWindow {
+			if err := redis_utils.DeleteJwtKey(kid); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func rotateIfDue() error {
+	key, err := ring.currentKey()
+	if err != nil {
+		return err
+	}
+
+	if time.Since(key.CreatedAt) > KeyRotationInterval {
+		if err := RotateSigningKey(); err != nil {
+			return err
+		}
+	}
+
+	return removeExpiredKeys()
+}
+
+func ScheduleKeyRotation() {
+	if err := rotateIfDue(); err != nil {
+		log_utils.Logger.Printf("Error: jwt_utils rotating signing key: %v", err)
+	}
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := rotateIfDue(); err != nil {
+			log_utils.Logger.Printf("Error: jwt_utils rotating signing key: %v", err)
+		}
+	}
+}
+
+// JWK 是 RFC 7517 中的公钥表示
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWKS 返回当前以及仍在重叠窗口内的全部公钥
+func PublicJWKS() (*JWKSet, error) {
+	if _, err := ring.currentKey(); err != nil {
+		return nil, fmt.Errorf("PublicJWKS: %v", err)
+	}
+
+	ring.mu.RLock()
+	defer ring.mu.RUnlock()
+
+	set := &JWKSet{Keys: []JWK{}}
+	for _, key := range ring.keys {
+		jwk := JWK{Kid: key.Kid, Alg: key.Alg, Use: "sig"}
+
+		switch public := key.Private.Public().(type) {
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		default:
+			continue
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set, nil
+}
@@ -0,0 +1,124 @@
+package jwt_utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+	"github.com/yux77yux/blog-backend/utils/redis_utils"
+)
+
+// refresh token 有效期，同一家族内每次轮换都会顺延
+const RefreshTokenTTL = time.Hour * 24 * 14
+
+func randomString(length int) (string, error) {
+	bytes := make([]byte, length)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// Redis 中只保存 refresh token 的哈希
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateRefreshToken 为一次新的登录创建 refresh token 家族，家族 ID 同时作为会话 ID
+func GenerateRefreshToken(uid string) (token string, family string, err error) {
+	family, err = randomString(16)
+	if err != nil {
+		return "", "", fmt.Errorf("GenerateRefreshToken family: %v", err)
+	}
+
+	token, err = issueRefreshToken(uid, family, time.Now().UnixMilli())
+	if err != nil {
+		return "", "", err
+	}
+	return token, family, nil
+}
+
+func issueRefreshToken(uid string, family string, familyIat int64) (string, error) {
+	token, err := randomString(32)
+	if err != nil {
+		return "", fmt.Errorf("issueRefreshToken rand.Read: %v", err)
+	}
+
+	err = redis_utils.StoreRefreshToken(hashRefreshToken(token), uid, family, familyIat, RefreshTokenTTL)
+	if err != nil {
+		return "", fmt.Errorf("issueRefreshToken: %v", err)
+	}
+
+	return token, nil
+}
+
+// RotateRefreshToken 用旧的 refresh token 换一个同家族的新 token；
+// 已经用过的 token 再次出现说明被盗用，直接吊销整个家族
+func RotateRefreshToken(token string) (uid string, family string, newToken string, err error) {
+	tokenHash := hashRefreshToken(token)
+
+	var (
+		familyIat int64
+		reused    bool
+	)
+	uid, family, familyIat, reused, err = redis_utils.UseRefreshToken(tokenHash)
+	if err == redis.Nil {
+		return "", "", "", fmt.Errorf("RotateRefreshToken: %w", ErrRefreshTokenInvalid)
+	}
+	if err != nil {
+		return "", "", "", fmt.Errorf("RotateRefreshToken: %v", err)
+	}
+
+	revokedBefore, err := redis_utils.GetTokensRevokedBefore(uid)
+	if err != nil {
+		return "", "", "", fmt.Errorf("RotateRefreshToken: %v", err)
+	}
+	if toMillis(familyIat) < toMillis(revokedBefore) {
+		return "", "", "", fmt.Errorf("RotateRefreshToken issued before %d: %w", revokedBefore, ErrRefreshTokenInvalid)
+	}
+
+	active, err := redis_utils.IsRefreshFamilyActive(family)
+	if err != nil {
+		return "", "", "", fmt.Errorf("RotateRefreshToken: %v", err)
+	}
+	if !active {
+		return "", "", "", fmt.Errorf("RotateRefreshToken family revoked: %w", ErrRefreshTokenInvalid)
+	}
+
+	if reused {
+		if err := redis_utils.DeleteSession(uid, family); err != nil {
+			log_utils.Logger.Printf("Error: RotateRefreshToken DeleteSession: %v", err)
+		}
+		log_utils.Logger.Printf("Warning: refresh token reuse detected for %s, family revoked", uid)
+		return "", "", "", fmt.Errorf("RotateRefreshToken: %w", ErrRefreshTokenReused)
+	}
+
+	newToken, err = issueRefreshToken(uid, family, familyIat)
+	if err != nil {
+		return "", "", "", fmt.Errorf("RotateRefreshToken: %v", err)
+	}
+
+	return uid, family, newToken, nil
+}
+
+// RevokeRefreshToken 吊销 token 所在的整个家族及其会话，用于退出登录
+func RevokeRefreshToken(token string) error {
+	uid, family, _, err := redis_utils.GetRefreshToken(hashRefreshToken(token))
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("RevokeRefreshToken: %v", err)
+	}
+
+	if err := redis_utils.DeleteSession(uid, family); err != nil {
+		return fmt.Errorf("RevokeRefreshToken: %v", err)
+	}
+	return nil
+}
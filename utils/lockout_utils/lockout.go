@@ -0,0 +1,149 @@
+package lockout_utils
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yux77yux/blog-backend/utils/redis_utils"
+	"github.com/yux77yux/blog-backend/utils/user_utils"
+)
+
+const (
+	// 统计失败次数的时间窗口
+	failureWindow = time.Minute * 15
+	// 同一账号（匹配不到账号时为同一登录名）允许连续失败的次数
+	usernameThreshold = 5
+	// 同一 IP 允许失败的次数，NAT 后面可能有多个用户，放宽一些
+	ipThreshold = 20
+	// 超过阈值后第一次锁定的时长，之后每多失败一次翻倍
+	baseLockout = time.Second * 30
+	maxLockout  = time.Hour
+)
+
+func usernameKey(username string) string {
+	return fmt.Sprintf("user:%s", strings.ToLower(strings.TrimSpace(username)))
+}
+
+func accountKey(uid string) string {
+	return fmt.Sprintf("account:%s", uid)
+}
+
+func ipKey(ip string) string {
+	return fmt.Sprintf("ip:%s", ip)
+}
+
+func lockoutFor(failures int64, threshold int64) time.Duration {
+	if failures < threshold {
+		return 0
+	}
+
+	lockout := baseLockout
+	for i := threshold; i < failures; i++ {
+		lockout *= 2
+		if lockout >= maxLockout {
+			return maxLockout
+		}
+	}
+	return lockout
+}
+
+// Account 把登录名解析为计数对象：匹配到账号时按 uid 计数，用户名和邮箱登录共用一个计数；
+// 匹配不到账号时按输入的登录名计数。查询失败时同样退回登录名，并返回错误供调用方记录
+func Account(login string) (string, error) {
+	uid, err := user_utils.FetchUidByLogin(login)
+	if err != nil {
+		return usernameKey(login), fmt.Errorf("lockout_utils Account: %v", err)
+	}
+	if uid == "" {
+		return usernameKey(login), nil
+	}
+	return accountKey(uid), nil
+}
+
+// AccountByUid 已经确定账号时使用，与 Account 解析出的计数对象相同
+func AccountByUid(uid string) string {
+	return accountKey(uid)
+}
+
+// Check 返回账号或 IP 当前剩余的锁定时间，未锁定时为 0；account 来自 Account 或 AccountByUid
+func Check(account string, ip string) (time.Duration, error) {
+	userTTL, err := redis_utils.GetLoginLockTTL(account)
+	if err != nil {
+		return 0, fmt.Errorf("lockout_utils Check: %v", err)
+	}
+
+	ipTTL, err := redis_utils.GetLoginLockTTL(ipKey(ip))
+	if err != nil {
+		return 0, fmt.Errorf("lockout_utils Check: %v", err)
+	}
+
+	if ipTTL > userTTL {
+		return ipTTL, nil
+	}
+	return userTTL, nil
+}
+
+// RecordFailure 记录一次失败登录；不论用户名是否存在都计数，避免泄露账号是否存在
+func RecordFailure(account string, ip string) (time.Duration, error) {
+	var retryAfter time.Duration
+
+	targets := []struct {
+		key       string
+		threshold int64
+	}{
+		{account, usernameThreshold},
+		{ipKey(ip), ipThreshold},
+	}
+
+	for _, target := range targets {
+		failures, err := redis_utils.IncrLoginFailure(target.key, failureWindow)
+		if err != nil {
+			return 0, fmt.Errorf("lockout_utils RecordFailure: %v", err)
+		}
+
+		lockout := lockoutFor(failures, target.threshold)
+		if lockout == 0 {
+			continue
+		}
+
+		if err := redis_utils.SetLoginLock(target.key, lockout); err != nil {
+			return 0, fmt.Errorf("lockout_utils RecordFailure: %v", err)
+		}
+		if lockout > retryAfter {
+			retryAfter = lockout
+		}
+	}
+
+	return retryAfter, nil
+}
+
+// RecordSuccess 登录成功后清空该账号的失败记录
+func RecordSuccess(account string) error {
+	if err := redis_utils.ResetLoginFailure(account); err != nil {
+		return fmt.Errorf("lockout_utils RecordSuccess: %v", err)
+	}
+	return nil
+}
+
+// Unlock 供管理员手动解除用户名或 IP 的锁定
+func Unlock(username string, ip string) error {
+	if username != "" {
+		account, err := Account(username)
+		if err != nil {
+			return fmt.Errorf("lockout_utils Unlock: %v", err)
+		}
+		// 账号的计数以及按原始输入记录的计数都清掉
+		for _, key := range []string{account, usernameKey(username)} {
+			if err := redis_utils.ResetLoginFailure(key); err != nil {
+				return fmt.Errorf("lockout_utils Unlock: %v", err)
+			}
+		}
+	}
+	if ip != "" {
+		if err := redis_utils.ResetLoginFailure(ipKey(ip)); err != nil {
+			return fmt.Errorf("lockout_utils Unlock: %v", err)
+		}
+	}
+	return nil
+}
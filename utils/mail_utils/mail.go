@@ -0,0 +1,117 @@
+package mail_utils
+
+import (
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer 负责投递邮件，测试和本地开发使用 FileMailer
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// 邮件中链接指向的前端地址，通过 BLOG_PUBLIC_URL 配置
+var PublicURL = getEnv("BLOG_PUBLIC_URL", "http://localhost:3000")
+
+// 默认投递方式：配置了 BLOG_SMTP_HOST 时走 SMTP，否则写入本地文件
+var Default Mailer = newDefaultMailer()
+
+func getEnv(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func newDefaultMailer() Mailer {
+	host := os.Getenv("BLOG_SMTP_HOST")
+	if host == "" {
+		return &FileMailer{Path: "./log/mail.log"}
+	}
+
+	return &SMTPMailer{
+		Host:     host,
+		Port:     getEnv("BLOG_SMTP_PORT", "587"),
+		Username: os.Getenv("BLOG_SMTP_USERNAME"),
+		Password: os.Getenv("BLOG_SMTP_PASSWORD"),
+		From:     getEnv("BLOG_SMTP_FROM", os.Getenv("BLOG_SMTP_USERNAME")),
+	}
+}
+
+func Send(msg Message) error {
+	return Default.Send(msg)
+}
+
+// 去掉换行，防止通过收件人或标题注入邮件头
+func headerValue(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
+
+func compose(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", headerValue(msg.Subject)))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	addr := net.JoinHostPort(m.Host, m.Port)
+	err := smtp.SendMail(addr, auth, m.From, []string{headerValue(msg.To)}, compose(m.From, msg))
+	if err != nil {
+		return fmt.Errorf("mail_utils SMTPMailer Send: %v", err)
+	}
+	return nil
+}
+
+// FileMailer 把邮件追加写入文件，不依赖邮件服务器
+type FileMailer struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file, err := os.OpenFile(m.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("mail_utils FileMailer OpenFile: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(compose("blog@localhost", msg), "\r\n.\r\n"...)); err != nil {
+		return fmt.Errorf("mail_utils FileMailer Write: %v", err)
+	}
+	return nil
+}
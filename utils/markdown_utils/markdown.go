@@ -0,0 +1,176 @@
+package markdown_utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yux77yux/blog-backend/internal/model"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+	"github.com/yux77yux/blog-backend/utils/redis_utils"
+)
+
+const (
+	// 修改渲染或过滤规则时递增，旧的缓存随之失效
+	rendererVersion = "1"
+	cacheTTL        = time.Hour * 24 * 7
+)
+
+type Rendered struct {
+	Html string           `json:"html"`
+	Toc  []model.TocEntry `json:"toc"`
+}
+
+// CommonMark + GFM（表格、删除线、任务列表、自动链接），原始 HTML 不输出
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+)
+
+var policy = newPolicy()
+
+// 在 UGC 白名单的基础上放行标题锚点、代码语言、任务列表和表格对齐
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("id").Matching(regexp.MustCompile(`^[\p{L}\p{N}_-]+$`)).OnElements("h1", "h2", "h3", "h4", "h5", "h6")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+-]+$`)).OnElements("code")
+	p.AllowElements("input")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	p.AllowStyles("text-align").MatchingEnum("left", "center", "right").OnElements("th", "td")
+	return p
+}
+
+// headingIDs 生成保留中文等字符的锚点，重复时追加 -1、-2
+type headingIDs struct {
+	used map[string]bool
+}
+
+func (ids *headingIDs) Generate(value []byte, kind ast.NodeKind) []byte {
+	var slug strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(string(value)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			slug.WriteRune(r)
+			dash = false
+		case unicode.IsSpace(r) || r == '-' || r == '_':
+			if slug.Len() > 0 && !dash {
+				slug.WriteRune('-')
+				dash = true
+			}
+		}
+	}
+
+	base := strings.TrimSuffix(slug.String(), "-")
+	if base == "" {
+		base = "heading"
+	}
+	id := base
+	for i := 1; ids.used[id]; i++ {
+		id = base + "-" + strconv.Itoa(i)
+	}
+	ids.used[id] = true
+	return []byte(id)
+}
+
+func (ids *headingIDs) Put(value []byte) {
+	ids.used[string(value)] = true
+}
+
+// 标题的纯文本，忽略强调、链接等格式
+func plainText(node ast.Node, source []byte) string {
+	var buffer bytes.Buffer
+	ast.Walk(node, func(child ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch child := child.(type) {
+		case *ast.Text:
+			buffer.Write(child.Segment.Value(source))
+			if child.SoftLineBreak() || child.HardLineBreak() {
+				buffer.WriteByte(' ')
+			}
+		case *ast.String:
+			buffer.Write(child.Value)
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.TrimSpace(buffer.String())
+}
+
+// render 不经过缓存直接渲染
+func render(content string) (*Rendered, error) {
+	source := []byte(content)
+	context := parser.NewContext(parser.WithIDs(&headingIDs{used: map[string]bool{}}))
+	document := markdown.Parser().Parse(text.NewReader(source), parser.WithContext(context))
+
+	rendered := &Rendered{Toc: []model.TocEntry{}}
+	ast.Walk(document, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := node.(*ast.Heading)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+		entry := model.TocEntry{Level: heading.Level, Text: plainText(heading, source)}
+		if id, ok := heading.AttributeString("id"); ok {
+			if id, ok := id.([]byte); ok {
+				entry.Id = string(id)
+			}
+		}
+		rendered.Toc = append(rendered.Toc, entry)
+		return ast.WalkSkipChildren, nil
+	})
+
+	var buffer bytes.Buffer
+	if err := markdown.Renderer().Render(&buffer, source, document); err != nil {
+		return nil, fmt.Errorf("markdown_utils render: %v", err)
+	}
+	rendered.Html = policy.Sanitize(buffer.String())
+	return rendered, nil
+}
+
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(rendererVersion + "\x00" + content))
+	return hex.EncodeToString(sum[:])
+}
+
+// Render 把 Markdown 渲染为过滤后的 HTML 和目录，相同正文只渲染一次
+func Render(content string) (*Rendered, error) {
+	hash := contentHash(content)
+
+	data, err := redis_utils.GetRenderedMarkdown(hash)
+	if err == nil {
+		var rendered Rendered
+		if err := json.Unmarshal([]byte(data), &rendered); err == nil {
+			return &rendered, nil
+		}
+	} else if err != redis.Nil {
+		log_utils.Logger.Printf("Error: markdown_utils Render GetRenderedMarkdown: %v", err)
+	}
+
+	rendered, err := render(content)
+	if err != nil {
+		return nil, err
+	}
+
+	if data, err := json.Marshal(rendered); err == nil {
+		if err := redis_utils.StoreRenderedMarkdown(hash, string(data), cacheTTL); err != nil {
+			log_utils.Logger.Printf("Error: markdown_utils Render StoreRenderedMarkdown: %v", err)
+		}
+	}
+	return rendered, nil
+}
@@ -0,0 +1,132 @@
+package mfa_utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+	"github.com/yux77yux/blog-backend/utils/redis_utils"
+	"github.com/yux77yux/blog-backend/utils/totp_utils"
+	"github.com/yux77yux/blog-backend/utils/user_utils"
+)
+
+const (
+	// 挑战的有效期，足够用户打开验证器 App
+	challengeTTL = time.Minute * 5
+	// 单个挑战允许的验证码尝试次数
+	maxAttempts = 5
+	// 同一用户两次创建挑战的最短间隔，避免反复输入密码刷新挑战来穷举验证码
+	ChallengeThrottle = time.Second * 30
+	// 启用两步验证时生成的恢复码数量
+	RecoveryCodeCount = 10
+)
+
+var (
+	ErrChallengeInvalid   = errors.New("two-factor challenge is invalid or expired")
+	ErrCodeInvalid        = errors.New("verification code is invalid")
+	ErrChallengeThrottled = errors.New("a two-factor challenge was issued recently, try again later")
+)
+
+func hashChallenge(challenge string) string {
+	sum := sha256.Sum256([]byte(challenge))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateChallenge 在密码校验通过后调用，返回换取 token 用的短期挑战
+func CreateChallenge(uid string) (string, error) {
+	ok, err := redis_utils.AcquireThrottle(fmt.Sprintf("mfa_challenge:%s", uid), ChallengeThrottle)
+	if err != nil {
+		return "", fmt.Errorf("mfa_utils CreateChallenge: %v", err)
+	}
+	if !ok {
+		return "", ErrChallengeThrottled
+	}
+
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("mfa_utils CreateChallenge: %v", err)
+	}
+	challenge := base64.RawURLEncoding.EncodeToString(bytes)
+
+	if err := redis_utils.StoreMfaChallenge(hashChallenge(challenge), uid, challengeTTL); err != nil {
+		return "", fmt.Errorf("mfa_utils CreateChallenge: %v", err)
+	}
+	return challenge, nil
+}
+
+// VerifyCode 校验 TOTP 验证码并防止同一个验证码被重放
+func VerifyCode(uid string, secret string, code string) (bool, error) {
+	step, ok := totp_utils.Validate(secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	fresh, err := redis_utils.UseTotpStep(uid, step, time.Second*totp_utils.Period*3)
+	if err != nil {
+		return false, fmt.Errorf("mfa_utils VerifyCode: %v", err)
+	}
+	return fresh, nil
+}
+
+// VerifySecondFactor 接受 TOTP 验证码或恢复码，任意一种通过即可
+func VerifySecondFactor(uid string, code string) (bool, error) {
+	secret, enabled, err := user_utils.GetTotp(uid)
+	if err != nil {
+		return false, fmt.Errorf("mfa_utils VerifySecondFactor: %v", err)
+	}
+	if !enabled {
+		return false, nil
+	}
+
+	ok, err := VerifyCode(uid, secret, code)
+	if err != nil || ok {
+		return ok, err
+	}
+
+	ok, err = user_utils.UseRecoveryCode(uid, code)
+	if err != nil {
+		return false, fmt.Errorf("mfa_utils VerifySecondFactor: %v", err)
+	}
+	if ok {
+		log_utils.Logger.Printf("Info: mfa_utils recovery code used by %s", uid)
+	}
+	return ok, nil
+}
+
+// ExchangeChallenge 用挑战和验证码换取登录资格，成功后挑战作废；
+// 验证码错误时同时返回 uid 与 ErrCodeInvalid，供调用方计入登录失败次数
+func ExchangeChallenge(challenge string, code string) (string, error) {
+	challengeHash := hashChallenge(challenge)
+
+	uid, attempts, err := redis_utils.AttemptMfaChallenge(challengeHash)
+	if err == redis.Nil {
+		return "", ErrChallengeInvalid
+	}
+	if err != nil {
+		return "", fmt.Errorf("mfa_utils ExchangeChallenge: %v", err)
+	}
+
+	if attempts > maxAttempts {
+		_ = redis_utils.DeleteMfaChallenge(challengeHash)
+		return "", ErrChallengeInvalid
+	}
+
+	ok, err := VerifySecondFactor(uid, code)
+	if err != nil {
+		return "", fmt.Errorf("mfa_utils ExchangeChallenge: %v", err)
+	}
+	if !ok {
+		return uid, ErrCodeInvalid
+	}
+
+	if err := redis_utils.DeleteMfaChallenge(challengeHash); err != nil {
+		log_utils.Logger.Printf("Error: mfa_utils ExchangeChallenge DeleteMfaChallenge: %v", err)
+	}
+	return uid, nil
+}
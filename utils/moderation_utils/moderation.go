@@ -0,0 +1,107 @@
+package moderation_utils
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yux77yux/blog-backend/internal/model"
+	"github.com/yux77yux/blog-backend/utils/jwt_utils"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+	"github.com/yux77yux/blog-backend/utils/redis_utils"
+	"github.com/yux77yux/blog-backend/utils/session_utils"
+	"github.com/yux77yux/blog-backend/utils/user_utils"
+)
+
+// 单次暂停的最长时长
+const MaxSuspendHours = 24 * 365
+
+var (
+	ErrAccountSuspended = errors.New("account is suspended")
+	ErrAccountBanned    = errors.New("account is banned")
+	ErrHoursInvalid     = errors.New("suspension must be 1 hour to 1 year")
+)
+
+// Suspend 暂停账号 hours 小时，到期后自动恢复
+func Suspend(uid string, hours int, reason string, hideContent bool) error {
+	if hours <= 0 || hours > MaxSuspendHours {
+		return ErrHoursInvalid
+	}
+
+	if err := user_utils.SetAccountState(uid, user_utils.AccountSuspended, hours, reason, hideContent); err != nil {
+		return fmt.Errorf("moderation_utils Suspend: %v", err)
+	}
+
+	return block(uid, "suspended", time.Duration(hours)*time.Hour, hideContent)
+}
+
+// Ban 永久封禁账号，只能由 Reinstate 解除
+func Ban(uid string, reason string, hideContent bool) error {
+	if err := user_utils.SetAccountState(uid, user_utils.AccountBanned, 0, reason, hideContent); err != nil {
+		return fmt.Errorf("moderation_utils Ban: %v", err)
+	}
+
+	return block(uid, "banned", 0, hideContent)
+}
+
+func Reinstate(uid string) error {
+	if err := user_utils.SetAccountState(uid, user_utils.AccountActive, 0, "", false); err != nil {
+		return fmt.Errorf("moderation_utils Reinstate: %v", err)
+	}
+
+	if err := redis_utils.ClearAccountBlocked(uid); err != nil {
+		return fmt.Errorf("moderation_utils Reinstate: %v", err)
+	}
+	if err := redis_utils.SetContentHidden(uid, false, 0); err != nil {
+		return fmt.Errorf("moderation_utils Reinstate: %v", err)
+	}
+	return nil
+}
+
+// 标记停用并让已签发的 token、会话全部失效
+func block(uid string, state string, ttl time.Duration, hideContent bool) error {
+	if err := redis_utils.SetAccountBlocked(uid, state, ttl); err != nil {
+		return fmt.Errorf("moderation_utils block: %v", err)
+	}
+
+	if err := jwt_utils.RevokeTokensIssuedBefore(uid, time.Now()); err != nil {
+		return fmt.Errorf("moderation_utils block: %v", err)
+	}
+
+	if err := session_utils.RevokeOtherSessions(uid, ""); err != nil {
+		return fmt.Errorf("moderation_utils block: %v", err)
+	}
+
+	if err := redis_utils.SetUserOnline(uid, false); err != nil {
+		log_utils.Logger.Printf("Error: moderation_utils block SetUserOnline: %v", err)
+	}
+
+	if err := redis_utils.SetContentHidden(uid, hideContent, ttl); err != nil {
+		return fmt.Errorf("moderation_utils block: %v", err)
+	}
+	if hideContent {
+		if err := redis_utils.DeleteUserFromRedis(uid); err != nil {
+			log_utils.Logger.Printf("Error: moderation_utils block DeleteUserFromRedis: %v", err)
+		}
+	}
+	return nil
+}
+
+// Check 登录时以数据库为准判断账号状态；暂停的 Redis 标记与暂停同时到期，封禁的标记在这里补上以防丢失
+func Check(uid string) (*model.AccountStatus, error) {
+	status, err := user_utils.FetchAccountStatus(uid)
+	if err != nil {
+		return nil, fmt.Errorf("moderation_utils Check: %v", err)
+	}
+
+	switch status.State {
+	case "suspended":
+		return status, ErrAccountSuspended
+	case "banned":
+		if err := redis_utils.SetAccountBlocked(uid, status.State, 0); err != nil {
+			log_utils.Logger.Printf("Error: moderation_utils Check: %v", err)
+		}
+		return status, ErrAccountBanned
+	}
+	return status, nil
+}
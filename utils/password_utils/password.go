@@ -0,0 +1,211 @@
+package password_utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Hasher 负责密码的哈希与校验，编码结果中自带算法与参数
+type Hasher interface {
+	Hash(password string) (string, error)
+	Verify(encoded string, password string) (bool, error)
+	// 编码中的参数弱于当前配置时返回 true
+	NeedsRehash(encoded string) bool
+}
+
+// 新密码统一使用的哈希器，可在启动时替换为 Argon2idHasher
+var Default Hasher = &BcryptHasher{Cost: 12}
+
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", fmt.Errorf("password_utils BcryptHasher Hash: %v", err)
+	}
+	return string(hashed), nil
+}
+
+func (h *BcryptHasher) Verify(encoded string, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("password_utils BcryptHasher Verify: %v", err)
+	}
+	return true, nil
+}
+
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	if err != nil {
+		return true
+	}
+	return cost < h.Cost
+}
+
+type Argon2idHasher struct {
+	Time    uint32
+	Memory  uint32 // KiB
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+func NewArgon2idHasher() *Argon2idHasher {
+	return &Argon2idHasher{
+		Time:    3,
+		Memory:  64 * 1024,
+		Threads: 2,
+		SaltLen: 16,
+		KeyLen:  32,
+	}
+}
+
+// 编码格式：$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("password_utils Argon2idHasher Hash rand.Read: %v", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *Argon2idHasher) Verify(encoded string, password string) (bool, error) {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return params.Time < h.Time ||
+		params.Memory < h.Memory ||
+		params.Threads < h.Threads ||
+		uint32(len(salt)) < h.SaltLen ||
+		uint32(len(key)) < h.KeyLen
+}
+
+func decodeArgon2id(encoded string) (*Argon2idHasher, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, nil, nil, fmt.Errorf("password_utils decodeArgon2id: invalid encoded hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, nil, nil, fmt.Errorf("password_utils decodeArgon2id version: %v", err)
+	}
+	if version != argon2.Version {
+		return nil, nil, nil, fmt.Errorf("password_utils decodeArgon2id: incompatible version %d", version)
+	}
+
+	params := &Argon2idHasher{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return nil, nil, nil, fmt.Errorf("password_utils decodeArgon2id params: %v", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("password_utils decodeArgon2id salt: %v", err)
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("password_utils decodeArgon2id key: %v", err)
+	}
+
+	return params, salt, key, nil
+}
+
+func isBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") ||
+		strings.HasPrefix(encoded, "$2b$") ||
+		strings.HasPrefix(encoded, "$2y$")
+}
+
+func isArgon2id(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+// 按编码前缀选择对应算法，参数取自编码本身
+func hasherFor(encoded string) Hasher {
+	switch {
+	case isBcrypt(encoded):
+		if h, ok := Default.(*BcryptHasher); ok {
+			return h
+		}
+		return &BcryptHasher{Cost: bcrypt.DefaultCost}
+	case isArgon2id(encoded):
+		if h, ok := Default.(*Argon2idHasher); ok {
+			return h
+		}
+		return NewArgon2idHasher()
+	}
+	return nil
+}
+
+var (
+	dummyOnce sync.Once
+	dummyHash string
+)
+
+// VerifyDummy 在用户名不存在时做一次等价的校验，让响应时间不暴露账号是否存在
+func VerifyDummy(password string) {
+	dummyOnce.Do(func() {
+		dummyHash, _ = Default.Hash("dummy-password")
+	})
+	_, _ = Verify(dummyHash, password)
+}
+
+func Hash(password string) (string, error) {
+	return Default.Hash(password)
+}
+
+// Verify 同时兼容旧的明文密码，明文行在下次登录时由 NeedsRehash 触发升级
+func Verify(encoded string, password string) (bool, error) {
+	if h := hasherFor(encoded); h != nil {
+		return h.Verify(encoded, password)
+	}
+	return subtle.ConstantTimeCompare([]byte(encoded), []byte(password)) == 1, nil
+}
+
+func NeedsRehash(encoded string) bool {
+	switch {
+	case isBcrypt(encoded):
+		if _, ok := Default.(*BcryptHasher); !ok {
+			return true
+		}
+	case isArgon2id(encoded):
+		if _, ok := Default.(*Argon2idHasher); !ok {
+			return true
+		}
+	default:
+		return true
+	}
+	return Default.NeedsRehash(encoded)
+}
@@ -0,0 +1,165 @@
+package pat_utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/yux77yux/blog-backend/internal/model"
+	"github.com/yux77yux/blog-backend/utils/jwt_utils"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+	"github.com/yux77yux/blog-backend/utils/rbac_utils"
+	"github.com/yux77yux/blog-backend/utils/redis_utils"
+	"github.com/yux77yux/blog-backend/utils/user_utils"
+)
+
+const (
+	// 令牌前缀，用来和 JWT 区分，也方便密钥扫描工具识别
+	Prefix = "bpat_"
+
+	DefaultTTLDays = 30
+	MaxTTLDays     = 365
+	// 每个用户最多持有的令牌数
+	MaxTokensPerUser = 20
+	// 最近使用时间的写入间隔，避免每次请求都更新数据库
+	touchInterval = time.Minute
+)
+
+var (
+	ErrTokenInvalid   = errors.New("access token is invalid or expired")
+	ErrNameInvalid    = errors.New("token name must be 1 to 100 characters")
+	ErrScopesRequired = errors.New("at least one scope is required")
+	ErrScopeNotHeld   = errors.New("cannot grant a scope you do not have")
+	ErrTTLInvalid     = errors.New("token lifetime must be 1 to 365 days")
+	ErrTooManyTokens  = errors.New("too many access tokens")
+)
+
+func IsAccessToken(token string) bool {
+	return strings.HasPrefix(token, Prefix)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomBytes(n int) ([]byte, error) {
+	bytes := make([]byte, n)
+	if _, err := rand.Read(bytes); err != nil {
+		return nil, err
+	}
+	return bytes, nil
+}
+
+// Create 生成新令牌，scopes 只能是用户当前拥有的权限；返回的明文 token 不会再保存
+func Create(uid string, request *model.NewAccessToken) (string, *model.AccessToken, error) {
+	name := strings.TrimSpace(request.Name)
+	if name == "" || utf8.RuneCountInString(name) > 100 {
+		return "", nil, ErrNameInvalid
+	}
+	if len(request.Scopes) == 0 {
+		return "", nil, ErrScopesRequired
+	}
+
+	days := request.ExpiresInDays
+	if days == 0 {
+		days = DefaultTTLDays
+	}
+	if days < 0 || days > MaxTTLDays {
+		return "", nil, ErrTTLInvalid
+	}
+
+	grants, err := rbac_utils.FetchGrants(uid)
+	if err != nil {
+		return "", nil, fmt.Errorf("pat_utils Create: %v", err)
+	}
+
+	scopes := []string{}
+	seen := map[string]bool{}
+	for _, scope := range request.Scopes {
+		if seen[scope] {
+			continue
+		}
+		if !rbac_utils.HasPermission(grants.Permissions, scope) {
+			return "", nil, fmt.Errorf("pat_utils Create %s: %w", scope, ErrScopeNotHeld)
+		}
+		seen[scope] = true
+		scopes = append(scopes, scope)
+	}
+
+	id, err := randomBytes(8)
+	if err != nil {
+		return "", nil, fmt.Errorf("pat_utils Create rand.Read: %v", err)
+	}
+	secret, err := randomBytes(32)
+	if err != nil {
+		return "", nil, fmt.Errorf("pat_utils Create rand.Read: %v", err)
+	}
+	token := Prefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	accessToken := &model.AccessToken{
+		TokenId: hex.EncodeToString(id),
+		Name:    name,
+		Scopes:  scopes,
+	}
+
+	added, err := user_utils.AddAccessToken(uid, accessToken, hashToken(token), days, MaxTokensPerUser)
+	if err != nil {
+		return "", nil, fmt.Errorf("pat_utils Create: %v", err)
+	}
+	if !added {
+		return "", nil, ErrTooManyTokens
+	}
+
+	return token, accessToken, nil
+}
+
+// Authenticate 校验令牌，返回所属用户、令牌 ID 以及本次请求实际拥有的权限
+func Authenticate(token string) (string, string, []string, error) {
+	uid, accessToken, expired, err := user_utils.FetchAccessTokenByHash(hashToken(token))
+	if err != nil {
+		return "", "", nil, fmt.Errorf("pat_utils Authenticate: %v", err)
+	}
+	if uid == "" || expired {
+		return "", "", nil, ErrTokenInvalid
+	}
+
+	state, err := redis_utils.GetAccountBlocked(uid)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("pat_utils Authenticate: %v", err)
+	}
+	if state != "" {
+		return "", "", nil, fmt.Errorf("pat_utils Authenticate account %s: %w", state, jwt_utils.ErrAccountDisabled)
+	}
+
+	// 角色被撤销后令牌也随之失去对应权限
+	grants, err := rbac_utils.FetchGrants(uid)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("pat_utils Authenticate: %v", err)
+	}
+
+	permissions := []string{}
+	for _, scope := range accessToken.Scopes {
+		if rbac_utils.HasPermission(grants.Permissions, scope) {
+			permissions = append(permissions, scope)
+		}
+	}
+
+	ok, err := redis_utils.AcquireThrottle(fmt.Sprintf("access_token_used:%s", accessToken.TokenId), touchInterval)
+	if err != nil {
+		log_utils.Logger.Printf("Error: pat_utils Authenticate: %v", err)
+	}
+	if ok {
+		if err := user_utils.TouchAccessToken(accessToken.TokenId); err != nil {
+			log_utils.Logger.Printf("Error: pat_utils Authenticate: %v", err)
+		}
+	}
+
+	return uid, accessToken.TokenId, permissions, nil
+}
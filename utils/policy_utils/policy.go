@@ -0,0 +1,263 @@
+package policy_utils
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+)
+
+// 内置的常见弱密码，BLOG_PASSWORD_DENYLIST 指定的文件会追加在它之后
+//
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// Violation 描述某个字段违反的一条规则
+type Violation struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PolicyError 汇总一次校验中的全部违规项
+type PolicyError struct {
+	Violations []Violation
+}
+
+func (e *PolicyError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, fmt.Sprintf("%s: %s", v.Field, v.Message))
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e *PolicyError) add(field string, code string, format string, args ...interface{}) {
+	e.Violations = append(e.Violations, Violation{
+		Field:   field,
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// 没有违规时返回 nil，方便直接作为 error 返回
+func (e *PolicyError) result() error {
+	if len(e.Violations) == 0 {
+		return nil
+	}
+	return e
+}
+
+type PasswordPolicy struct {
+	MinLength int
+	// bcrypt 只取前 72 字节，超出部分会被拒绝
+	MaxLength int
+	// 小写、大写、数字、符号四类中至少包含几类
+	MinClasses int
+	// 不允许密码中包含用户名
+	ForbidUsername bool
+	// 弱密码文件路径，每行一个，忽略大小写
+	DenylistPath string
+
+	denylistOnce sync.Once
+	denylist     map[string]struct{}
+}
+
+type UsernamePolicy struct {
+	MinLength int
+	MaxLength int
+	Pattern   *regexp.Regexp
+	// 保留名称，忽略大小写
+	Reserved map[string]struct{}
+}
+
+type Policy struct {
+	Password *PasswordPolicy
+	Username *UsernamePolicy
+}
+
+var defaultReserved = []string{
+	"admin", "administrator", "root", "system", "api", "www", "support",
+	"help", "blog", "official", "null", "undefined", "me", "user",
+}
+
+// 部署时通过环境变量调整，未设置的项使用默认值
+var Default = NewPolicyFromEnv()
+
+func envInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log_utils.Logger.Printf("Error: policy_utils %s is not a number: %v", key, err)
+		return fallback
+	}
+	return n
+}
+
+func NewPolicyFromEnv() *Policy {
+	pattern := `^[A-Za-z0-9][A-Za-z0-9_.-]*$`
+	if value := os.Getenv("BLOG_USERNAME_PATTERN"); value != "" {
+		pattern = value
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		log_utils.Logger.Printf("Error: policy_utils BLOG_USERNAME_PATTERN invalid: %v", err)
+		re = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+	}
+
+	reserved := make(map[string]struct{})
+	names := defaultReserved
+	if value := os.Getenv("BLOG_USERNAME_RESERVED"); value != "" {
+		names = append(names, strings.Split(value, ",")...)
+	}
+	for _, name := range names {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			reserved[name] = struct{}{}
+		}
+	}
+
+	return &Policy{
+		Password: &PasswordPolicy{
+			MinLength:      envInt("BLOG_PASSWORD_MIN_LENGTH", 8),
+			MaxLength:      envInt("BLOG_PASSWORD_MAX_LENGTH", 72),
+			MinClasses:     envInt("BLOG_PASSWORD_MIN_CLASSES", 2),
+			ForbidUsername: os.Getenv("BLOG_PASSWORD_ALLOW_USERNAME") == "",
+			DenylistPath:   os.Getenv("BLOG_PASSWORD_DENYLIST"),
+		},
+		Username: &UsernamePolicy{
+			MinLength: envInt("BLOG_USERNAME_MIN_LENGTH", 3),
+			MaxLength: envInt("BLOG_USERNAME_MAX_LENGTH", 20),
+			Pattern:   re,
+			Reserved:  reserved,
+		},
+	}
+}
+
+func addLines(set map[string]struct{}, scanner *bufio.Scanner) {
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		set[line] = struct{}{}
+	}
+}
+
+func (p *PasswordPolicy) loadDenylist() {
+	p.denylist = make(map[string]struct{})
+	addLines(p.denylist, bufio.NewScanner(strings.NewReader(commonPasswords)))
+
+	if p.DenylistPath == "" {
+		return
+	}
+
+	file, err := os.Open(p.DenylistPath)
+	if err != nil {
+		log_utils.Logger.Printf("Error: policy_utils loadDenylist: %v", err)
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	addLines(p.denylist, scanner)
+	if err := scanner.Err(); err != nil {
+		log_utils.Logger.Printf("Error: policy_utils loadDenylist: %v", err)
+	}
+}
+
+func (p *PasswordPolicy) denied(password string) bool {
+	p.denylistOnce.Do(p.loadDenylist)
+	_, ok := p.denylist[strings.ToLower(password)]
+	return ok
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+// Check 校验密码，username 为空时跳过与用户名相关的规则
+func (p *PasswordPolicy) Check(password string, username string) []Violation {
+	errs := &PolicyError{}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		errs.add("password", "too_short", "must be at least %d characters", p.MinLength)
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		errs.add("password", "too_long", "must be at most %d bytes", p.MaxLength)
+	}
+	if classes := characterClasses(password); classes < p.MinClasses {
+		errs.add("password", "too_simple", "must mix at least %d of lowercase, uppercase, digits and symbols", p.MinClasses)
+	}
+	if p.ForbidUsername && username != "" &&
+		strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		errs.add("password", "contains_username", "must not contain the username")
+	}
+	if p.denied(password) {
+		errs.add("password", "too_common", "is too common, choose another one")
+	}
+
+	return errs.Violations
+}
+
+func (u *UsernamePolicy) Check(username string) []Violation {
+	errs := &PolicyError{}
+
+	length := utf8.RuneCountInString(username)
+	if length < u.MinLength || length > u.MaxLength {
+		errs.add("username", "length", "must be %d to %d characters", u.MinLength, u.MaxLength)
+	}
+	if u.Pattern != nil && !u.Pattern.MatchString(username) {
+		errs.add("username", "charset", "may only contain letters, digits, '_', '.' and '-', starting with a letter or digit")
+	}
+	if _, ok := u.Reserved[strings.ToLower(username)]; ok {
+		errs.add("username", "reserved", "is reserved")
+	}
+
+	return errs.Violations
+}
+
+// ValidateSignUp 同时校验用户名和密码，返回全部违规项
+func (p *Policy) ValidateSignUp(username string, password string) error {
+	errs := &PolicyError{}
+	errs.Violations = append(errs.Violations, p.Username.Check(username)...)
+	errs.Violations = append(errs.Violations, p.Password.Check(password, username)...)
+	return errs.result()
+}
+
+func (p *Policy) ValidatePassword(password string, username string) error {
+	errs := &PolicyError{Violations: p.Password.Check(password, username)}
+	return errs.result()
+}
+
+func ValidateSignUp(username string, password string) error {
+	return Default.ValidateSignUp(username, password)
+}
+
+func ValidatePassword(password string, username string) error {
+	return Default.ValidatePassword(password, username)
+}
@@ -0,0 +1,306 @@
+package rbac_utils
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yux77yux/blog-backend/config"
+	"github.com/yux77yux/blog-backend/utils/jwt_utils"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+	"github.com/yux77yux/blog-backend/utils/redis_utils"
+)
+
+const (
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleAuthor = "author"
+
+	// 新注册账号默认获得的角色
+	DefaultRole = RoleAuthor
+)
+
+const (
+	PermArticleWrite     = "article:write"      // 发布和修改自己的文章
+	PermArticleEditAny   = "article:edit_any"   // 修改或下架任何人的文章
+	PermArticleDeleteAny = "article:delete_any" // 删除任何人的文章
+	PermCommentModerate  = "comment:moderate"   // 审核评论
+	PermUserModerate     = "user:moderate"      // 封禁、解锁账号
+	PermRoleManage       = "role:manage"        // 授予和撤销角色
+	PermAuditRead        = "audit:read"         // 查看所有人的审计日志
+	PermProfileRead      = "profile:read"       // 导出自己的数据、查看自己的审计日志
+	PermProfileWrite     = "profile:write"      // 修改自己的昵称、简介和资料
+)
+
+// 内置角色及其权限，启动建表时写入数据库
+var DefaultRoles = map[string][]string{
+	RoleAuthor: {
+		PermArticleWrite,
+		PermProfileRead,
+		PermProfileWrite,
+	},
+	RoleEditor: {
+		PermArticleWrite,
+		PermArticleEditAny,
+		PermCommentModerate,
+		PermProfileRead,
+		PermProfileWrite,
+	},
+	RoleAdmin: {
+		PermArticleWrite,
+		PermArticleEditAny,
+		PermArticleDeleteAny,
+		PermCommentModerate,
+		PermUserModerate,
+		PermRoleManage,
+		PermAuditRead,
+		PermProfileRead,
+		PermProfileWrite,
+	},
+}
+
+var (
+	ErrRoleNotFound = errors.New("role does not exist")
+	ErrUserNotFound = errors.New("user does not exist")
+	// 撤销最后一个管理员会导致无人能再授予角色
+	ErrLastAdmin = errors.New("cannot revoke the last admin")
+)
+
+// Grants 是写入 JWT 的角色与权限
+type Grants struct {
+	Roles       []string
+	Permissions []string
+}
+
+// FetchGrants 返回用户的全部角色以及这些角色合并后的权限
+func FetchGrants(uid string) (*Grants, error) {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	query := `
+	SELECT 
+	role.name AS role,
+	permission.name AS permission
+	FROM user_role
+	INNER JOIN user_incidental ON user_incidental.id = user_role.id
+	INNER JOIN role ON role.roleId = user_role.roleId
+	LEFT JOIN role_permission ON role_permission.roleId = role.roleId
+	LEFT JOIN permission ON permission.permissionId = role_permission.permissionId
+	WHERE user_incidental.uid = ? 
+	`
+
+	rows, err := config.DB.Query(query, uid)
+	if err != nil {
+		return nil, fmt.Errorf("rbac_utils FetchGrants Query: %v", err)
+	}
+	defer rows.Close()
+
+	roles := map[string]bool{}
+	permissions := map[string]bool{}
+	for rows.Next() {
+		var (
+			role       string
+			permission sql.NullString
+		)
+		if err := rows.Scan(&role, &permission); err != nil {
+			return nil, fmt.Errorf("rbac_utils FetchGrants Scan: %v", err)
+		}
+		roles[role] = true
+		if permission.Valid {
+			permissions[permission.String] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rbac_utils FetchGrants rows: %v", err)
+	}
+
+	return &Grants{Roles: sortedKeys(roles), Permissions: sortedKeys(permissions)}, nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// GrantRole 给用户授予角色，已拥有时不报错；grantedBy 为空表示系统授予
+func GrantRole(uid string, role string, grantedBy string) error {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	if err := grantRole(uid, role, grantedBy); err != nil {
+		return err
+	}
+
+	// 写入失败时旧 token 仍带着原有权限，不能当作成功
+	if err := claimsChanged(uid); err != nil {
+		return fmt.Errorf("rbac_utils GrantRole: %v", err)
+	}
+	return nil
+}
+
+// 需要调用方已打开数据库
+func grantRole(uid string, role string, grantedBy string) error {
+	var grantor sql.NullString
+	if grantedBy != "" {
+		grantor = sql.NullString{String: grantedBy, Valid: true}
+	}
+
+	query := `
+	INSERT IGNORE INTO user_role (id, roleId, grantedBy, grantedAt)
+	SELECT user_incidental.id, role.roleId, ?, ?
+	FROM user_incidental, role
+	WHERE user_incidental.uid = ? 
+	AND role.name = ? 
+	`
+
+	result, err := config.DB.Exec(query, grantor, time.Now(), uid, role)
+	if err != nil {
+		return fmt.Errorf("rbac_utils GrantRole Exec: %v", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rbac_utils GrantRole RowsAffected: %v", err)
+	}
+	if affected == 0 {
+		// 没有插入时区分是已拥有还是用户、角色不存在
+		return checkTargets(uid, role, "GrantRole")
+	}
+	return nil
+}
+
+func checkTargets(uid string, role string, caller string) error {
+	var count int
+	query := `
+	SELECT COUNT(*)
+	FROM role
+	WHERE role.name = ? 
+	`
+	if err := config.DB.QueryRow(query, role).Scan(&count); err != nil {
+		return fmt.Errorf("rbac_utils %s QueryRow: %v", caller, err)
+	}
+	if count == 0 {
+		return fmt.Errorf("rbac_utils %s: %w", caller, ErrRoleNotFound)
+	}
+
+	query = `
+	SELECT COUNT(*)
+	FROM user_incidental
+	WHERE user_incidental.uid = ? 
+	`
+	if err := config.DB.QueryRow(query, uid).Scan(&count); err != nil {
+		return fmt.Errorf("rbac_utils %s QueryRow: %v", caller, err)
+	}
+	if count == 0 {
+		return fmt.Errorf("rbac_utils %s: %w", caller, ErrUserNotFound)
+	}
+	return nil
+}
+
+// RevokeRole 撤销用户的角色，未拥有时不报错
+func RevokeRole(uid string, role string) error {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("rbac_utils RevokeRole Begin: %v", err)
+	}
+
+	if role == RoleAdmin {
+		// 锁住管理员的授权记录，避免两个管理员同时互相撤销
+		query := `
+		SELECT user_incidental.uid
+		FROM user_role
+		INNER JOIN role ON role.roleId = user_role.roleId
+		INNER JOIN user_incidental ON user_incidental.id = user_role.id
+		WHERE role.name = ? 
+		FOR UPDATE
+		`
+		rows, err := tx.Query(query, RoleAdmin)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("rbac_utils RevokeRole Query: %v", err)
+		}
+
+		admins := map[string]bool{}
+		for rows.Next() {
+			var adminUid string
+			if err := rows.Scan(&adminUid); err != nil {
+				rows.Close()
+				tx.Rollback()
+				return fmt.Errorf("rbac_utils RevokeRole Scan: %v", err)
+			}
+			admins[adminUid] = true
+		}
+		rows.Close()
+
+		if admins[uid] && len(admins) == 1 {
+			tx.Rollback()
+			return fmt.Errorf("rbac_utils RevokeRole: %w", ErrLastAdmin)
+		}
+	}
+
+	query := `
+	DELETE user_role
+	FROM user_role
+	INNER JOIN user_incidental ON user_incidental.id = user_role.id
+	INNER JOIN role ON role.roleId = user_role.roleId
+	WHERE user_incidental.uid = ? 
+	AND role.name = ? 
+	`
+
+	if _, err := tx.Exec(query, uid, role); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("rbac_utils RevokeRole Exec: %v", err)
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("rbac_utils RevokeRole Commit: %v", err)
+	}
+
+	// 写入失败时旧 token 仍带着被撤销的权限，不能当作成功
+	if err := claimsChanged(uid); err != nil {
+		return fmt.Errorf("rbac_utils RevokeRole: %v", err)
+	}
+	return nil
+}
+
+// 角色变化后让已签发的 access token 失效，客户端刷新后拿到新的权限；精确到毫秒
+func claimsChanged(uid string) error {
+	if err := redis_utils.SetClaimsChangedAt(uid, time.Now().UnixMilli(), jwt_utils.AccessTokenTTL); err != nil {
+		return fmt.Errorf("claimsChanged: %v", err)
+	}
+	return nil
+}
+
+// BootstrapAdmins 把 BLOG_ADMIN_UIDS（逗号分隔）中的账号设为管理员，用于初始化第一个管理员
+func BootstrapAdmins() {
+	for _, uid := range strings.Split(os.Getenv("BLOG_ADMIN_UIDS"), ",") {
+		if uid = strings.TrimSpace(uid); uid == "" {
+			continue
+		}
+		if err := GrantRole(uid, RoleAdmin, ""); err != nil {
+			log_utils.Logger.Printf("Error: rbac_utils BootstrapAdmins %s: %v", uid, err)
+		}
+	}
+}
+
+// HasPermission 判断权限列表中是否包含 permission
+func HasPermission(permissions []string, permission string) bool {
+	for _, p := range permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -1,7 +1,6 @@
 package redis_utils
 
 import (
-	"encoding/base64"
 	"fmt"
 	"strconv"
 	"time"
@@ -85,33 +84,589 @@ func IsJtiBlacklisted(jti string) (bool, error) {
 	return score > float64(time.Now().Unix()), nil
 }
 
-func ExistsSigningKeyInRedix(uid string) (bool, error) {
-	field := fmt.Sprintf("signingKey_%s", uid)
-	val, err := config.RDB.Exists(config.CTX, field).Result()
+// 记录某个用户的吊销时间点（毫秒），iat 早于它的 token 一律视为失效；
+// 超过 token 有效期后这些 token 自然过期，键也随之失效
+func SetTokensRevokedBefore(uid string, timestamp int64, ttl time.Duration) error {
+	key := fmt.Sprintf("revoked_before:%s", uid)
+	err := config.RDB.Set(config.CTX, key, timestamp, ttl).Err()
 	if err != nil {
-		return false, fmt.Errorf("redis_utils checking key is not exists: %v", err)
+		return fmt.Errorf("redis_utils SetTokensRevokedBefore Set: %v", err)
+	}
+	return nil
+}
+
+func GetTokensRevokedBefore(uid string) (int64, error) {
+	key := fmt.Sprintf("revoked_before:%s", uid)
+	value, err := config.RDB.Get(config.CTX, key).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("redis_utils GetTokensRevokedBefore Get: %v", err)
+	}
+	return value, nil
+}
+
+// 角色或权限变化的时间点（毫秒），iat 早于它的 access token 需要刷新后才能拿到新的 claims
+func SetClaimsChangedAt(uid string, timestamp int64, ttl time.Duration) error {
+	key := fmt.Sprintf("claims_changed:%s", uid)
+	err := config.RDB.Set(config.CTX, key, timestamp, ttl).Err()
+	if err != nil {
+		return fmt.Errorf("redis_utils SetClaimsChangedAt Set: %v", err)
+	}
+	return nil
+}
+
+func GetClaimsChangedAt(uid string) (int64, error) {
+	key := fmt.Sprintf("claims_changed:%s", uid)
+	value, err := config.RDB.Get(config.CTX, key).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("redis_utils GetClaimsChangedAt Get: %v", err)
+	}
+	return value, nil
+}
+
+// 被停用账号的状态（suspended / banned），ttl 为 0 表示不过期；token 校验时只查这里，不访问数据库
+func SetAccountBlocked(uid string, state string, ttl time.Duration) error {
+	key := fmt.Sprintf("account_blocked:%s", uid)
+	err := config.RDB.Set(config.CTX, key, state, ttl).Err()
+	if err != nil {
+		return fmt.Errorf("redis_utils SetAccountBlocked Set: %v", err)
+	}
+	return nil
+}
+
+func ClearAccountBlocked(uid string) error {
+	key := fmt.Sprintf("account_blocked:%s", uid)
+	err := config.RDB.Del(config.CTX, key).Err()
+	if err != nil {
+		return fmt.Errorf("redis_utils ClearAccountBlocked Del: %v", err)
+	}
+	return nil
+}
+
+// GetAccountBlocked 未停用时返回空字符串
+func GetAccountBlocked(uid string) (string, error) {
+	key := fmt.Sprintf("account_blocked:%s", uid)
+	state, err := config.RDB.Get(config.CTX, key).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("redis_utils GetAccountBlocked Get: %v", err)
+	}
+	return state, nil
+}
+
+// 内容被隐藏的用户，公开读取接口据此返回不存在；ttl 与暂停时长一致，为 0 时不过期
+func SetContentHidden(uid string, hidden bool, ttl time.Duration) error {
+	key := fmt.Sprintf("content_hidden:%s", uid)
+	var err error
+	if hidden {
+		err = config.RDB.Set(config.CTX, key, 1, ttl).Err()
+	} else {
+		err = config.RDB.Del(config.CTX, key).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("redis_utils SetContentHidden: %v", err)
+	}
+	return nil
+}
+
+func IsContentHidden(uid string) (bool, error) {
+	key := fmt.Sprintf("content_hidden:%s", uid)
+	count, err := config.RDB.Exists(config.CTX, key).Result()
+	if err != nil {
+		return false, fmt.Errorf("redis_utils IsContentHidden Exists: %v", err)
+	}
+	return count > 0, nil
+}
+
+func DeleteUserFromRedis(uid string) error {
+	key := fmt.Sprintf("user:%s", uid)
+	err := config.RDB.Del(config.CTX, key).Err()
+	if err != nil {
+		return fmt.Errorf("redis_utils DeleteUserFromRedis Del: %v", err)
+	}
+	return nil
+}
+
+// refresh token 以哈希值为键保存，used 字段用于检测重放
+// familyIat 是整个家族首次签发的时间（毫秒），用于按时间点批量吊销
+func StoreRefreshToken(tokenHash string, uid string, family string, familyIat int64, ttl time.Duration) error {
+	key := fmt.Sprintf("refresh:%s", tokenHash)
+	familyKey := fmt.Sprintf("refresh_family:%s", family)
+
+	pipe := config.RDB.TxPipeline()
+	pipe.HSet(config.CTX, key, map[string]interface{}{
+		"uid":       uid,
+		"family":    family,
+		"familyIat": familyIat,
+		"used":      0,
+	})
+	pipe.Expire(config.CTX, key, ttl)
+	// 每次轮换都顺延整个家族的有效期
+	pipe.Set(config.CTX, familyKey, uid, ttl)
+	if _, err := pipe.Exec(config.CTX); err != nil {
+		return fmt.Errorf("redis_utils StoreRefreshToken Exec: %v", err)
+	}
+	return nil
+}
+
+func GetRefreshToken(tokenHash string) (uid string, family string, familyIat int64, err error) {
+	key := fmt.Sprintf("refresh:%s", tokenHash)
+	data, err := config.RDB.HGetAll(config.CTX, key).Result()
+	if err != nil {
+		return "", "", 0, fmt.Errorf("redis_utils GetRefreshToken HGetAll: %v", err)
+	}
+	if len(data) == 0 {
+		return "", "", 0, redis.Nil
+	}
+
+	familyIat, err = strconv.ParseInt(data["familyIat"], 10, 64)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("redis_utils GetRefreshToken ParseInt: %v", err)
+	}
+	return data["uid"], data["family"], familyIat, nil
+}
+
+// 读取与标记在同一个脚本里完成，key 已过期或被删除时不会被 HINCRBY 重新创建成没有 TTL 的 key
+var useRefreshTokenScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return false
+end
+local used = redis.call('HINCRBY', KEYS[1], 'used', 1)
+local values = redis.call('HMGET', KEYS[1], 'uid', 'family', 'familyIat')
+return {values[1], values[2], values[3], used}
+`)
+
+// UseRefreshToken 原子地读取 refresh token 并标记为已使用，reused 表示它之前已经被用过；不存在时返回 redis.Nil
+func UseRefreshToken(tokenHash string) (uid string, family string, familyIat int64, reused bool, err error) {
+	key := fmt.Sprintf("refresh:%s", tokenHash)
+	values, err := useRefreshTokenScript.Run(config.CTX, config.RDB, []string{key}).Slice()
+	if err == redis.Nil {
+		return "", "", 0, false, redis.Nil
+	}
+	if err != nil {
+		return "", "", 0, false, fmt.Errorf("redis_utils UseRefreshToken Run: %v", err)
+	}
+	if len(values) != 4 {
+		return "", "", 0, false, fmt.Errorf("redis_utils UseRefreshToken: unexpected reply %v", values)
+	}
+
+	uid, _ = values[0].(string)
+	family, _ = values[1].(string)
+	iat, _ := values[2].(string)
+	used, _ := values[3].(int64)
+	familyIat, err = strconv.ParseInt(iat, 10, 64)
+	if err != nil {
+		return "", "", 0, false, fmt.Errorf("redis_utils UseRefreshToken ParseInt: %v", err)
+	}
+	return uid, family, familyIat, used > 1, nil
+}
+
+func IsRefreshFamilyActive(family string) (bool, error) {
+	familyKey := fmt.Sprintf("refresh_family:%s", family)
+	val, err := config.RDB.Exists(config.CTX, familyKey).Result()
+	if err != nil {
+		return false, fmt.Errorf("redis_utils IsRefreshFamilyActive Exists: %v", err)
 	}
 	return val > 0, nil
 }
 
-func StoreSigningKeyInRedis(uid string, signingKey []byte) error {
-	field := fmt.Sprintf("signingKey_%s", uid)
-	encodedKey := base64.StdEncoding.EncodeToString(signingKey)
-	return config.RDB.Set(config.CTX, field, encodedKey, 0).Err()
+// 计数与设置过期时间在同一个脚本里完成，没有过期时间的旧计数也会补上
+var loginFailureScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+if count == 1 or redis.call('PTTL', KEYS[1]) < 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return count
+`)
+
+// 登录失败计数，窗口从第一次失败开始计算
+func IncrLoginFailure(key string, window time.Duration) (int64, error) {
+	key = fmt.Sprintf("login_fail:%s", key)
+	count, err := loginFailureScript.Run(config.CTX, config.RDB, []string{key}, window.Milliseconds()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("redis_utils IncrLoginFailure Run: %v", err)
+	}
+	return count, nil
+}
+
+func ResetLoginFailure(key string) error {
+	pipe := config.RDB.TxPipeline()
+	pipe.Del(config.CTX, fmt.Sprintf("login_fail:%s", key))
+	pipe.Del(config.CTX, fmt.Sprintf("login_lock:%s", key))
+	if _, err := pipe.Exec(config.CTX); err != nil {
+		return fmt.Errorf("redis_utils ResetLoginFailure Exec: %v", err)
+	}
+	return nil
 }
 
-func RetrieveSigningKeyInRedis(uid string) ([]byte, error) {
-	field := fmt.Sprintf("signingKey_%s", uid)
-	value, err := config.RDB.Get(config.CTX, field).Result()
+func SetLoginLock(key string, ttl time.Duration) error {
+	key = fmt.Sprintf("login_lock:%s", key)
+	if err := config.RDB.Set(config.CTX, key, 1, ttl).Err(); err != nil {
+		return fmt.Errorf("redis_utils SetLoginLock Set: %v", err)
+	}
+	return nil
+}
+
+// 返回锁定剩余时间，未锁定时为 0
+func GetLoginLockTTL(key string) (time.Duration, error) {
+	key = fmt.Sprintf("login_lock:%s", key)
+	ttl, err := config.RDB.TTL(config.CTX, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("redis_utils GetLoginLockTTL TTL: %v", err)
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// 两步验证挑战，密码校验通过后发放，换取 token 前有效
+func StoreMfaChallenge(challengeHash string, uid string, ttl time.Duration) error {
+	key := fmt.Sprintf("mfa_challenge:%s", challengeHash)
+	pipe := config.RDB.TxPipeline()
+	pipe.HSet(config.CTX, key, "uid", uid, "attempts", 0)
+	pipe.Expire(config.CTX, key, ttl)
+	if _, err := pipe.Exec(config.CTX); err != nil {
+		return fmt.Errorf("redis_utils StoreMfaChallenge Exec: %v", err)
+	}
+	return nil
+}
+
+// 挑战存在时累加 attempts 并返回 ARGV 指定的字段和累加后的次数；
+// 先判断 EXISTS，避免挑战恰好过期时 HINCRBY 重建一个没有过期时间的键
+var attemptChallengeScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return false
+end
+local attempts = redis.call('HINCRBY', KEYS[1], 'attempts', 1)
+local values = redis.call('HMGET', KEYS[1], unpack(ARGV))
+table.insert(values, attempts)
+return values
+`)
+
+// 返回挑战对应的 uid 以及累计尝试次数（含本次），挑战不存在时返回 redis.Nil
+func AttemptMfaChallenge(challengeHash string) (string, int64, error) {
+	key := fmt.Sprintf("mfa_challenge:%s", challengeHash)
+	values, err := attemptChallengeScript.Run(config.CTX, config.RDB, []string{key}, "uid").Slice()
+	if err == redis.Nil {
+		return "", 0, redis.Nil
+	}
 	if err != nil {
-		return nil, fmt.Errorf("redis_utils retrieving signing key from Redis: %v", err)
+		return "", 0, fmt.Errorf("redis_utils AttemptMfaChallenge Run: %v", err)
+	}
+	if len(values) != 2 {
+		return "", 0, fmt.Errorf("redis_utils AttemptMfaChallenge: unexpected reply %v", values)
 	}
 
-	signingKey, err := base64.StdEncoding.DecodeString(value)
+	uid, _ := values[0].(string)
+	attempts, _ := values[1].(int64)
+	return uid, attempts, nil
+}
+
+func DeleteMfaChallenge(challengeHash string) error {
+	key := fmt.Sprintf("mfa_challenge:%s", challengeHash)
+	return config.RDB.Del(config.CTX, key).Err()
+}
+
+// 异地登录的二次验证挑战，保存 uid 与邮件验证码的哈希
+func StoreStepUpChallenge(challengeHash string, uid string, codeHash string, ttl time.Duration) error {
+	key := fmt.Sprintf("step_up_challenge:%s", challengeHash)
+	pipe := config.RDB.TxPipeline()
+	pipe.HSet(config.CTX, key, "uid", uid, "code", codeHash, "attempts", 0)
+	pipe.Expire(config.CTX, key, ttl)
+	if _, err := pipe.Exec(config.CTX); err != nil {
+		return fmt.Errorf("redis_utils StoreStepUpChallenge Exec: %v", err)
+	}
+	return nil
+}
+
+// 返回 uid、验证码哈希以及累计尝试次数（含本次），挑战不存在时返回 redis.Nil
+func AttemptStepUpChallenge(challengeHash string) (string, string, int64, error) {
+	key := fmt.Sprintf("step_up_challenge:%s", challengeHash)
+	values, err := attemptChallengeScript.Run(config.CTX, config.RDB, []string{key}, "uid", "code").Slice()
+	if err == redis.Nil {
+		return "", "", 0, redis.Nil
+	}
 	if err != nil {
-		return nil, fmt.Errorf("redis_utils DecodeString: %v", err)
+		return "", "", 0, fmt.Errorf("redis_utils AttemptStepUpChallenge Run: %v", err)
+	}
+	if len(values) != 3 {
+		return "", "", 0, fmt.Errorf("redis_utils AttemptStepUpChallenge: unexpected reply %v", values)
 	}
-	return signingKey, nil
+
+	uid, _ := values[0].(string)
+	codeHash, _ := values[1].(string)
+	attempts, _ := values[2].(int64)
+	return uid, codeHash, attempts, nil
+}
+
+func DeleteStepUpChallenge(challengeHash string) error {
+	key := fmt.Sprintf("step_up_challenge:%s", challengeHash)
+	return config.RDB.Del(config.CTX, key).Err()
+}
+
+// 只接受比上次更新的时间步，同一个 TOTP 验证码不能用两次
+var totpStepScript = redis.NewScript(`
+local last = tonumber(redis.call('GET', KEYS[1]) or '-1')
+if tonumber(ARGV[1]) <= last then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'EX', ARGV[2])
+return 1
+`)
+
+func UseTotpStep(uid string, step int64, ttl time.Duration) (bool, error) {
+	key := fmt.Sprintf("totp_last_step:%s", uid)
+	ok, err := totpStepScript.Run(config.CTX, config.RDB, []string{key}, step, int64(ttl/time.Second)).Int()
+	if err != nil {
+		return false, fmt.Errorf("redis_utils UseTotpStep Run: %v", err)
+	}
+	return ok == 1, nil
+}
+
+// WebAuthn 仪式的中间状态，begin 时写入，finish 时取出并删除
+func StoreWebauthnSession(key string, data string, ttl time.Duration) error {
+	key = fmt.Sprintf("webauthn_session:%s", key)
+	if err := config.RDB.Set(config.CTX, key, data, ttl).Err(); err != nil {
+		return fmt.Errorf("redis_utils StoreWebauthnSession Set: %v", err)
+	}
+	return nil
+}
+
+func TakeWebauthnSession(key string) (string, error) {
+	key = fmt.Sprintf("webauthn_session:%s", key)
+	data, err := config.RDB.GetDel(config.CTX, key).Result()
+	if err == redis.Nil {
+		return "", redis.Nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("redis_utils TakeWebauthnSession GetDel: %v", err)
+	}
+	return data, nil
+}
+
+// 一次性令牌（找回密码等），以哈希为键，取出即删除
+func StoreOneTimeToken(kind string, tokenHash string, value string, ttl time.Duration) error {
+	key := fmt.Sprintf("%s:%s", kind, tokenHash)
+	if err := config.RDB.Set(config.CTX, key, value, ttl).Err(); err != nil {
+		return fmt.Errorf("redis_utils StoreOneTimeToken Set: %v", err)
+	}
+	return nil
+}
+
+// PeekOneTimeToken 只读取不消耗，用于在消耗前先做校验
+func PeekOneTimeToken(kind string, tokenHash string) (string, error) {
+	key := fmt.Sprintf("%s:%s", kind, tokenHash)
+	value, err := config.RDB.Get(config.CTX, key).Result()
+	if err == redis.Nil {
+		return "", redis.Nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("redis_utils PeekOneTimeToken Get: %v", err)
+	}
+	return value, nil
+}
+
+func TakeOneTimeToken(kind string, tokenHash string) (string, error) {
+	key := fmt.Sprintf("%s:%s", kind, tokenHash)
+	value, err := config.RDB.GetDel(config.CTX, key).Result()
+	if err == redis.Nil {
+		return "", redis.Nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("redis_utils TakeOneTimeToken GetDel: %v", err)
+	}
+	return value, nil
+}
+
+// 在 ttl 内只允许一次，用于限制发信频率
+func AcquireThrottle(key string, ttl time.Duration) (bool, error) {
+	ok, err := config.RDB.SetNX(config.CTX, fmt.Sprintf("throttle:%s", key), 1, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("redis_utils AcquireThrottle SetNX: %v", err)
+	}
+	return ok, nil
+}
+
+// IP 地理位置缓存，多个实例共享
+func StoreGeoCache(ip string, data string, ttl time.Duration) error {
+	key := fmt.Sprintf("geoip:%s", ip)
+	if err := config.RDB.Set(config.CTX, key, data, ttl).Err(); err != nil {
+		return fmt.Errorf("redis_utils StoreGeoCache Set: %v", err)
+	}
+	return nil
+}
+
+func GetGeoCache(ip string) (string, error) {
+	key := fmt.Sprintf("geoip:%s", ip)
+	data, err := config.RDB.Get(config.CTX, key).Result()
+	if err == redis.Nil {
+		return "", redis.Nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("redis_utils GetGeoCache Get: %v", err)
+	}
+	return data, nil
+}
+
+// Markdown 渲染结果缓存，键为渲染器版本与正文的哈希
+func StoreRenderedMarkdown(hash string, data string, ttl time.Duration) error {
+	key := fmt.Sprintf("markdown:%s", hash)
+	if err := config.RDB.Set(config.CTX, key, data, ttl).Err(); err != nil {
+		return fmt.Errorf("redis_utils StoreRenderedMarkdown Set: %v", err)
+	}
+	return nil
+}
+
+func GetRenderedMarkdown(hash string) (string, error) {
+	key := fmt.Sprintf("markdown:%s", hash)
+	data, err := config.RDB.Get(config.CTX, key).Result()
+	if err == redis.Nil {
+		return "", redis.Nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("redis_utils GetRenderedMarkdown Get: %v", err)
+	}
+	return data, nil
+}
+
+// 会话保存在 session:<sid> 哈希中，sessions:<uid> 集合记录该用户的全部会话
+func StoreSession(uid string, sid string, fields map[string]interface{}, ttl time.Duration) error {
+	key := fmt.Sprintf("session:%s", sid)
+	setKey := fmt.Sprintf("sessions:%s", uid)
+
+	pipe := config.RDB.TxPipeline()
+	pipe.HSet(config.CTX, key, fields)
+	pipe.Expire(config.CTX, key, ttl)
+	pipe.SAdd(config.CTX, setKey, sid)
+	if _, err := pipe.Exec(config.CTX); err != nil {
+		return fmt.Errorf("redis_utils StoreSession Exec: %v", err)
+	}
+	return nil
+}
+
+// 只更新仍然存在的会话，避免把已撤销的会话重新写回来
+var touchSessionScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	redis.call('HSET', KEYS[1], unpack(ARGV, 2))
+	redis.call('EXPIRE', KEYS[1], ARGV[1])
+	return 1
+end
+return 0
+`)
+
+func TouchSession(sid string, fields map[string]interface{}, ttl time.Duration) error {
+	key := fmt.Sprintf("session:%s", sid)
+
+	args := []interface{}{int64(ttl / time.Second)}
+	for field, value := range fields {
+		args = append(args, field, value)
+	}
+
+	if err := touchSessionScript.Run(config.CTX, config.RDB, []string{key}, args...).Err(); err != nil {
+		return fmt.Errorf("redis_utils TouchSession Run: %v", err)
+	}
+	return nil
+}
+
+func GetSession(sid string) (map[string]string, error) {
+	key := fmt.Sprintf("session:%s", sid)
+	data, err := config.RDB.HGetAll(config.CTX, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis_utils GetSession HGetAll: %v", err)
+	}
+	return data, nil
+}
+
+func SessionExists(sid string) (bool, error) {
+	key := fmt.Sprintf("session:%s", sid)
+	val, err := config.RDB.Exists(config.CTX, key).Result()
+	if err != nil {
+		return false, fmt.Errorf("redis_utils SessionExists Exists: %v", err)
+	}
+	return val > 0, nil
+}
+
+func ListSessionIDs(uid string) ([]string, error) {
+	setKey := fmt.Sprintf("sessions:%s", uid)
+	sids, err := config.RDB.SMembers(config.CTX, setKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis_utils ListSessionIDs SMembers: %v", err)
+	}
+	return sids, nil
+}
+
+// 删除会话的同时吊销对应的 refresh token 家族
+func DeleteSession(uid string, sid string) error {
+	pipe := config.RDB.TxPipeline()
+	pipe.Del(config.CTX, fmt.Sprintf("session:%s", sid))
+	pipe.Del(config.CTX, fmt.Sprintf("refresh_family:%s", sid))
+	pipe.SRem(config.CTX, fmt.Sprintf("sessions:%s", uid), sid)
+	if _, err := pipe.Exec(config.CTX); err != nil {
+		return fmt.Errorf("redis_utils DeleteSession Exec: %v", err)
+	}
+	return nil
+}
+
+// 服务端签名密钥保存在 jwt_keys 哈希中，字段为 kid
+func StoreJwtKey(kid string, data string) error {
+	if err := config.RDB.HSet(config.CTX, "jwt_keys", kid, data).Err(); err != nil {
+		return fmt.Errorf("redis_utils StoreJwtKey HSet: %v", err)
+	}
+	return nil
+}
+
+func GetJwtKeys() (map[string]string, error) {
+	keys, err := config.RDB.HGetAll(config.CTX, "jwt_keys").Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis_utils GetJwtKeys HGetAll: %v", err)
+	}
+	return keys, nil
+}
+
+func DeleteJwtKey(kid string) error {
+	if err := config.RDB.HDel(config.CTX, "jwt_keys", kid).Err(); err != nil {
+		return fmt.Errorf("redis_utils DeleteJwtKey HDel: %v", err)
+	}
+	return nil
+}
+
+func SetCurrentJwtKid(kid string) error {
+	if err := config.RDB.Set(config.CTX, "jwt_current_kid", kid, 0).Err(); err != nil {
+		return fmt.Errorf("redis_utils SetCurrentJwtKid Set: %v", err)
+	}
+	return nil
+}
+
+func GetCurrentJwtKid() (string, error) {
+	kid, err := config.RDB.Get(config.CTX, "jwt_current_kid").Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("redis_utils GetCurrentJwtKid Get: %v", err)
+	}
+	return kid, nil
+}
+
+// 多实例部署时保证同一时间只有一个实例在轮换密钥
+func AcquireJwtKeyRotationLock(ttl time.Duration) (bool, error) {
+	ok, err := config.RDB.SetNX(config.CTX, "jwt_key_rotation_lock", 1, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("redis_utils AcquireJwtKeyRotationLock SetNX: %v", err)
+	}
+	return ok, nil
+}
+
+func ReleaseJwtKeyRotationLock() error {
+	return config.RDB.Del(config.CTX, "jwt_key_rotation_lock").Err()
 }
 
 func ModifyUserField(uid string, field string, value interface{}) error {
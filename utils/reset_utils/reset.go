@@ -0,0 +1,129 @@
+package reset_utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/yux77yux/blog-backend/utils/jwt_utils"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+	"github.com/yux77yux/blog-backend/utils/mail_utils"
+	"github.com/yux77yux/blog-backend/utils/policy_utils"
+	"github.com/yux77yux/blog-backend/utils/redis_utils"
+	"github.com/yux77yux/blog-backend/utils/session_utils"
+	"github.com/yux77yux/blog-backend/utils/user_utils"
+)
+
+const (
+	// 重置链接的有效期
+	resetTokenTTL = time.Minute * 30
+	// 同一用户两次发信的最短间隔
+	resetThrottle = time.Minute
+)
+
+var ErrResetTokenInvalid = errors.New("password reset link is invalid or expired")
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RequestReset 给用户发送重置链接；用户名不存在或未填写邮箱时同样返回 nil，不暴露账号信息
+func RequestReset(username string) error {
+	uid, email, err := user_utils.FetchEmailByUsername(username)
+	if err != nil {
+		return fmt.Errorf("reset_utils RequestReset: %v", err)
+	}
+	if uid == "" || email == "" {
+		return nil
+	}
+
+	ok, err := redis_utils.AcquireThrottle(fmt.Sprintf("password_reset:%s", uid), resetThrottle)
+	if err != nil {
+		return fmt.Errorf("reset_utils RequestReset: %v", err)
+	}
+	if !ok {
+		return nil
+	}
+
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return fmt.Errorf("reset_utils RequestReset rand.Read: %v", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(bytes)
+
+	if err := redis_utils.StoreOneTimeToken("password_reset", hashToken(token), uid, resetTokenTTL); err != nil {
+		return fmt.Errorf("reset_utils RequestReset: %v", err)
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", mail_utils.PublicURL, url.QueryEscape(token))
+	err = mail_utils.Send(mail_utils.Message{
+		To:      email,
+		Subject: "重置密码",
+		Body: fmt.Sprintf("你好 %s：\n\n请在 %d 分钟内打开以下链接重置密码：\n%s\n\n如果不是你本人操作，请忽略这封邮件。\n",
+			username, int(resetTokenTTL.Minutes()), link),
+	})
+	if err != nil {
+		return fmt.Errorf("reset_utils RequestReset: %v", err)
+	}
+	return nil
+}
+
+// ConfirmReset 用重置令牌设置新密码，并让该用户所有已登录的会话失效
+func ConfirmReset(token string, password string) (string, error) {
+	uid, err := redis_utils.PeekOneTimeToken("password_reset", hashToken(token))
+	if err == redis.Nil {
+		return "", ErrResetTokenInvalid
+	}
+	if err != nil {
+		return "", fmt.Errorf("reset_utils ConfirmReset: %v", err)
+	}
+
+	// 先按完整的规则（包括用户名）校验，避免令牌被无效的新密码白白消耗
+	username, err := user_utils.FetchUsername(uid)
+	if err != nil {
+		return "", fmt.Errorf("reset_utils ConfirmReset: %v", err)
+	}
+	if err := policy_utils.ValidatePassword(password, username); err != nil {
+		return "", fmt.Errorf("reset_utils ConfirmReset: %w", err)
+	}
+
+	// 校验通过后才消耗令牌，同时发起的请求只有一个能拿到
+	taken, err := redis_utils.TakeOneTimeToken("password_reset", hashToken(token))
+	if err == redis.Nil || (err == nil && taken != uid) {
+		return "", ErrResetTokenInvalid
+	}
+	if err != nil {
+		return "", fmt.Errorf("reset_utils ConfirmReset: %v", err)
+	}
+
+	if err := user_utils.UpdatePassword(uid, password); err != nil {
+		return "", fmt.Errorf("reset_utils ConfirmReset: %w", err)
+	}
+
+	if err := RevokeAllSessions(uid, ""); err != nil {
+		log_utils.Logger.Printf("Error: reset_utils ConfirmReset: %v", err)
+	}
+	return uid, nil
+}
+
+// RevokeAllSessions 密码变更后调用，keepSid 非空时保留发起修改的会话
+func RevokeAllSessions(uid string, keepSid string) error {
+	if err := session_utils.RevokeOtherSessions(uid, keepSid); err != nil {
+		return fmt.Errorf("reset_utils RevokeAllSessions: %v", err)
+	}
+
+	// 没有会话的旧 token 也一并失效
+	if keepSid == "" {
+		if err := jwt_utils.RevokeTokensIssuedBefore(uid, time.Now()); err != nil {
+			return fmt.Errorf("reset_utils RevokeAllSessions: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,303 @@
+package risk_utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/yux77yux/blog-backend/internal/model"
+	"github.com/yux77yux/blog-backend/utils/email_utils"
+	"github.com/yux77yux/blog-backend/utils/ipinfo"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+	"github.com/yux77yux/blog-backend/utils/redis_utils"
+	"github.com/yux77yux/blog-backend/utils/user_utils"
+)
+
+// 被标记的原因
+const (
+	ReasonNewCountry       = "new_country"
+	ReasonNewRegion        = "new_region"
+	ReasonNewNetwork       = "new_network"
+	ReasonImpossibleTravel = "impossible_travel"
+)
+
+const (
+	// 参与比较的最近登录记录条数
+	historyLimit = 50
+	// 距离小于此值时不判断移动速度，IP 定位本身有几百公里的误差
+	minTravelKm = 500
+	// 邮件验证码的有效期与尝试次数
+	stepUpTTL         = time.Minute * 10
+	maxStepUpAttempts = 5
+	// 同一用户两次发送验证码的最短间隔，避免反复登录刷新挑战来穷举验证码
+	StepUpThrottle = time.Minute
+	// 同一位置的提醒邮件最短间隔
+	alertThrottle = time.Hour
+)
+
+var (
+	ErrChallengeInvalid = errors.New("sign-in verification is invalid or expired")
+	ErrCodeInvalid      = errors.New("verification code is invalid")
+	ErrStepUpThrottled  = errors.New("a verification code was sent recently, try again later")
+)
+
+type Config struct {
+	// 登录历史保留天数
+	HistoryDays int
+	// 超过这个速度（公里/小时）视为不可能的移动
+	MaxSpeedKmh float64
+	// 被标记时是否要求邮件验证码，开启两步验证的账号直接走 TOTP
+	StepUp bool
+}
+
+// 默认配置，可通过 BLOG_SIGNIN_* 环境变量覆盖
+var Default = loadConfig()
+
+func envInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log_utils.Logger.Printf("Error: risk_utils %s is not a number: %v", key, err)
+		return fallback
+	}
+	return n
+}
+
+func loadConfig() *Config {
+	return &Config{
+		HistoryDays: envInt("BLOG_SIGNIN_HISTORY_DAYS", 90),
+		MaxSpeedKmh: float64(envInt("BLOG_SIGNIN_MAX_SPEED_KMH", 1000)),
+		StepUp:      os.Getenv("BLOG_SIGNIN_STEP_UP") != "",
+	}
+}
+
+func (c *Config) history() time.Duration {
+	return time.Duration(c.HistoryDays) * time.Hour * 24
+}
+
+type Assessment struct {
+	Location *model.SignInLocation
+	Reasons  []string
+	Flagged  bool
+}
+
+// Locate 查询 IP 的地理位置，查不到国家时 Country 为空
+func Locate(ip string) (*model.SignInLocation, error) {
+	info, err := ipinfo.GetIPInfo(ip)
+	if err != nil {
+		return nil, fmt.Errorf("risk_utils Locate: %v", err)
+	}
+
+	location := &model.SignInLocation{
+		IP:      ip,
+		Country: info.Country,
+		Region:  info.Region,
+		City:    info.City,
+		ASN:     info.ASN(),
+	}
+	if latitude, longitude, ok := info.Coordinates(); ok {
+		location.Latitude = &latitude
+		location.Longitude = &longitude
+	}
+	return location, nil
+}
+
+// 两点间的大圆距离，单位公里
+func distanceKm(a *model.SignInLocation, b *model.SignInLocation) float64 {
+	const earthRadiusKm = 6371
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	lat1, lat2 := toRad(*a.Latitude), toRad(*b.Latitude)
+	dLat := lat2 - lat1
+	dLon := toRad(*b.Longitude - *a.Longitude)
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Evaluate 把本次位置与最近的登录历史比较，history 按时间倒序
+func (c *Config) Evaluate(location *model.SignInLocation, history []*model.SignInLocation) *Assessment {
+	assessment := &Assessment{Location: location, Reasons: []string{}}
+	// 没有定位结果或没有历史时无从比较
+	if location.Country == "" || len(history) == 0 {
+		return assessment
+	}
+
+	seenCountry, seenRegion, seenNetwork := false, false, location.ASN == ""
+	for _, past := range history {
+		if past.Country == location.Country {
+			seenCountry = true
+			if past.Region == location.Region {
+				seenRegion = true
+			}
+		}
+		if past.ASN == location.ASN {
+			seenNetwork = true
+		}
+	}
+	if !seenCountry {
+		assessment.Reasons = append(assessment.Reasons, ReasonNewCountry)
+	} else if !seenRegion {
+		assessment.Reasons = append(assessment.Reasons, ReasonNewRegion)
+	}
+	if !seenNetwork {
+		assessment.Reasons = append(assessment.Reasons, ReasonNewNetwork)
+	}
+	// 同一地区换网络、或同一运营商跨地区都很常见，两者同时变化才算新位置
+	assessment.Flagged = !seenCountry || (!seenRegion && !seenNetwork)
+
+	last := history[0]
+	if location.Latitude != nil && last.Latitude != nil {
+		distance := distanceKm(location, last)
+		hours := math.Max(float64(last.SecondsAgo), 60) / 3600
+		if distance > minTravelKm && distance/hours > c.MaxSpeedKmh {
+			assessment.Reasons = append(assessment.Reasons, ReasonImpossibleTravel)
+			assessment.Flagged = true
+		}
+	}
+
+	return assessment
+}
+
+// Assess 评估一次密码校验通过的登录
+func Assess(uid string, ip string) (*Assessment, error) {
+	location, err := Locate(ip)
+	if err != nil {
+		return nil, fmt.Errorf("risk_utils Assess: %v", err)
+	}
+
+	history, err := user_utils.FetchSignInLocations(uid, Default.history(), historyLimit)
+	if err != nil {
+		return nil, fmt.Errorf("risk_utils Assess: %v", err)
+	}
+
+	return Default.Evaluate(location, history), nil
+}
+
+// Remember 登录完成后记录位置，只记成功的登录，未通过验证的位置不会变成熟悉的位置
+func Remember(uid string, ip string) {
+	location, err := Locate(ip)
+	if err != nil {
+		log_utils.Logger.Printf("Error: risk_utils Remember: %v", err)
+		return
+	}
+	if location.Country == "" {
+		return
+	}
+
+	if err := user_utils.AddSignInLocation(uid, location, Default.history()); err != nil {
+		log_utils.Logger.Printf("Error: risk_utils Remember: %v", err)
+	}
+}
+
+// Notify 给已验证的邮箱发送异地登录提醒，同一位置一小时内只发一次
+func Notify(uid string, assessment *Assessment) error {
+	email, _, err := user_utils.FetchEmail(uid)
+	if err != nil {
+		return fmt.Errorf("risk_utils Notify: %v", err)
+	}
+	if email == "" {
+		return nil
+	}
+
+	location := assessment.Location
+	key := fmt.Sprintf("signin_alert:%s:%s:%s:%s", uid, location.Country, location.Region, location.ASN)
+	ok, err := redis_utils.AcquireThrottle(key, alertThrottle)
+	if err != nil {
+		return fmt.Errorf("risk_utils Notify: %v", err)
+	}
+	if !ok {
+		return nil
+	}
+
+	if err := email_utils.NotifySuspiciousSignIn(email, location); err != nil {
+		return fmt.Errorf("risk_utils Notify: %v", err)
+	}
+	return nil
+}
+
+func hash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateStepUp 给已验证的邮箱发送验证码并返回挑战，没有已验证的邮箱时返回空字符串
+func CreateStepUp(uid string) (string, error) {
+	email, _, err := user_utils.FetchEmail(uid)
+	if err != nil {
+		return "", fmt.Errorf("risk_utils CreateStepUp: %v", err)
+	}
+	if email == "" {
+		return "", nil
+	}
+
+	ok, err := redis_utils.AcquireThrottle(fmt.Sprintf("step_up:%s", uid), StepUpThrottle)
+	if err != nil {
+		return "", fmt.Errorf("risk_utils CreateStepUp: %v", err)
+	}
+	if !ok {
+		return "", ErrStepUpThrottled
+	}
+
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("risk_utils CreateStepUp rand.Read: %v", err)
+	}
+	challenge := base64.RawURLEncoding.EncodeToString(bytes)
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", fmt.Errorf("risk_utils CreateStepUp rand.Int: %v", err)
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	if err := redis_utils.StoreStepUpChallenge(hash(challenge), uid, hash(code), stepUpTTL); err != nil {
+		return "", fmt.Errorf("risk_utils CreateStepUp: %v", err)
+	}
+
+	if err := email_utils.SendStepUpCode(email, code, stepUpTTL); err != nil {
+		return "", fmt.Errorf("risk_utils CreateStepUp: %v", err)
+	}
+	return challenge, nil
+}
+
+// ExchangeStepUp 用挑战和邮件验证码换取登录资格，成功后挑战作废；
+// 验证码错误时同时返回 uid 与 ErrCodeInvalid，供调用方计入登录失败次数
+func ExchangeStepUp(challenge string, code string) (string, error) {
+	challengeHash := hash(challenge)
+
+	uid, codeHash, attempts, err := redis_utils.AttemptStepUpChallenge(challengeHash)
+	if err == redis.Nil {
+		return "", ErrChallengeInvalid
+	}
+	if err != nil {
+		return "", fmt.Errorf("risk_utils ExchangeStepUp: %v", err)
+	}
+
+	if attempts > maxStepUpAttempts {
+		_ = redis_utils.DeleteStepUpChallenge(challengeHash)
+		return "", ErrChallengeInvalid
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hash(code)), []byte(codeHash)) != 1 {
+		return uid, ErrCodeInvalid
+	}
+
+	if err := redis_utils.DeleteStepUpChallenge(challengeHash); err != nil {
+		log_utils.Logger.Printf("Error: risk_utils ExchangeStepUp DeleteStepUpChallenge: %v", err)
+	}
+	return uid, nil
+}
@@ -0,0 +1,163 @@
+package session_utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/yux77yux/blog-backend/internal/model"
+	"github.com/yux77yux/blog-backend/utils/ipinfo"
+	"github.com/yux77yux/blog-backend/utils/jwt_utils"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+	"github.com/yux77yux/blog-backend/utils/redis_utils"
+)
+
+// 最近访问时间的最小更新间隔，避免每个请求都写 Redis
+const touchInterval = time.Minute
+
+// 会话不存在或不属于当前用户
+var ErrSessionNotFound = errors.New("session not found")
+
+func CreateSession(uid string, sid string, r *http.Request) error {
+	now := time.Now().Unix()
+	ip := ipinfo.GetClientIP(r)
+
+	err := redis_utils.StoreSession(uid, sid, map[string]interface{}{
+		"uid":       uid,
+		"createdAt": now,
+		"lastSeen":  now,
+		"ip":        ip,
+		"userAgent": r.UserAgent(),
+	}, jwt_utils.RefreshTokenTTL)
+	if err != nil {
+		return fmt.Errorf("session_utils CreateSession: %v", err)
+	}
+
+	// 地理位置查询走外部服务，不阻塞登录
+	go func() {
+		info, err := ipinfo.GetIPInfo(ip)
+		if err != nil {
+			log_utils.Logger.Printf("Error: session_utils CreateSession GetIPInfo: %v", err)
+			return
+		}
+
+		err = redis_utils.TouchSession(sid, map[string]interface{}{
+			"city":    info.City,
+			"country": info.Country,
+		}, jwt_utils.RefreshTokenTTL)
+		if err != nil {
+			log_utils.Logger.Printf("Error: session_utils CreateSession TouchSession: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+// TouchSession 记录会话最近一次访问及当前 access token
+func TouchSession(sid string, jti string) error {
+	data, err := redis_utils.GetSession(sid)
+	if err != nil {
+		return fmt.Errorf("session_utils TouchSession: %v", err)
+	}
+
+	lastSeen, _ := strconv.ParseInt(data["lastSeen"], 10, 64)
+	if data["jti"] == jti && time.Since(time.Unix(lastSeen, 0)) < touchInterval {
+		return nil
+	}
+
+	fields := map[string]interface{}{
+		"lastSeen": time.Now().Unix(),
+	}
+	if jti != "" {
+		fields["jti"] = jti
+	}
+
+	if err := redis_utils.TouchSession(sid, fields, jwt_utils.RefreshTokenTTL); err != nil {
+		return fmt.Errorf("session_utils TouchSession: %v", err)
+	}
+	return nil
+}
+
+func ListSessions(uid string, currentSid string) ([]*model.Session, error) {
+	sids, err := redis_utils.ListSessionIDs(uid)
+	if err != nil {
+		return nil, fmt.Errorf("session_utils ListSessions: %v", err)
+	}
+
+	sessions := make([]*model.Session, 0, len(sids))
+	for _, sid := range sids {
+		data, err := redis_utils.GetSession(sid)
+		if err != nil {
+			return nil, fmt.Errorf("session_utils ListSessions: %v", err)
+		}
+
+		// 会话已过期，顺便从集合中清理掉
+		if len(data) == 0 {
+			if err := redis_utils.DeleteSession(uid, sid); err != nil {
+				log_utils.Logger.Printf("Error: session_utils ListSessions DeleteSession: %v", err)
+			}
+			continue
+		}
+
+		createdAt, _ := strconv.ParseInt(data["createdAt"], 10, 64)
+		lastSeen, _ := strconv.ParseInt(data["lastSeen"], 10, 64)
+
+		sessions = append(sessions, &model.Session{
+			Sid:       sid,
+			Jti:       data["jti"],
+			CreatedAt: createdAt,
+			LastSeen:  lastSeen,
+			IP:        data["ip"],
+			UserAgent: data["userAgent"],
+			City:      data["city"],
+			Country:   data["country"],
+			Current:   sid == currentSid,
+		})
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeen > sessions[j].LastSeen
+	})
+
+	return sessions, nil
+}
+
+// RevokeSession 撤销会话，对应的 access token 和 refresh token 立即失效
+func RevokeSession(uid string, sid string) error {
+	data, err := redis_utils.GetSession(sid)
+	if err != nil {
+		return fmt.Errorf("session_utils RevokeSession: %v", err)
+	}
+	if len(data) != 0 && data["uid"] != uid {
+		return fmt.Errorf("session_utils RevokeSession %s: %w", sid, ErrSessionNotFound)
+	}
+
+	// 会话已过期时仍从该用户的会话列表中移除
+	if err := redis_utils.DeleteSession(uid, sid); err != nil {
+		return fmt.Errorf("session_utils RevokeSession: %v", err)
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("session_utils RevokeSession %s: %w", sid, ErrSessionNotFound)
+	}
+	return nil
+}
+
+func RevokeOtherSessions(uid string, currentSid string) error {
+	sids, err := redis_utils.ListSessionIDs(uid)
+	if err != nil {
+		return fmt.Errorf("session_utils RevokeOtherSessions: %v", err)
+	}
+
+	for _, sid := range sids {
+		if sid == currentSid {
+			continue
+		}
+		if err := redis_utils.DeleteSession(uid, sid); err != nil {
+			return fmt.Errorf("session_utils RevokeOtherSessions: %v", err)
+		}
+	}
+	return nil
+}
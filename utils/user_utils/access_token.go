@@ -0,0 +1,206 @@
+package user_utils
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/yux77yux/blog-backend/config"
+	"github.com/yux77yux/blog-backend/internal/model"
+)
+
+func splitScopes(scopes string) []string {
+	if scopes == "" {
+		return []string{}
+	}
+	return strings.Split(scopes, ",")
+}
+
+// AddAccessToken 保存令牌的哈希，超过 limit 个时拒绝
+func AddAccessToken(uid string, token *model.AccessToken, tokenHash string, expiresInDays int, limit int) (bool, error) {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	id, _, err := userIDByUid(uid)
+	if err != nil {
+		return false, fmt.Errorf("user_utils AddAccessToken %v", err)
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return false, fmt.Errorf("user_utils AddAccessToken Begin: %v", err)
+	}
+
+	// 锁住该用户的令牌，避免并发创建时超过上限
+	query := `
+	SELECT COUNT(*)
+	FROM personal_access_token
+	WHERE personal_access_token.id = ? 
+	FOR UPDATE
+	`
+	var count int
+	if err := tx.QueryRow(query, id).Scan(&count); err != nil {
+		tx.Rollback()
+		return false, fmt.Errorf("user_utils AddAccessToken QueryRow: %v", err)
+	}
+	if count >= limit {
+		tx.Rollback()
+		return false, nil
+	}
+
+	query = `
+	INSERT INTO personal_access_token (tokenId, id, name, tokenHash, scopes, createdAt, expiresAt) VALUES
+	(?, ?, ?, ?, ?, NOW(), DATE_ADD(NOW(), INTERVAL ? DAY))
+	`
+	_, err = tx.Exec(query, token.TokenId, id, token.Name, tokenHash, strings.Join(token.Scopes, ","), expiresInDays)
+	if err != nil {
+		tx.Rollback()
+		return false, fmt.Errorf("user_utils AddAccessToken Exec: %v", err)
+	}
+
+	query = `
+	SELECT createdAt, expiresAt
+	FROM personal_access_token
+	WHERE personal_access_token.tokenId = ? 
+	`
+	if err := tx.QueryRow(query, token.TokenId).Scan(&token.CreatedAt, &token.ExpiresAt); err != nil {
+		tx.Rollback()
+		return false, fmt.Errorf("user_utils AddAccessToken QueryRow: %v", err)
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("user_utils AddAccessToken Commit: %v", err)
+	}
+	return true, nil
+}
+
+func FetchAccessTokens(uid string) ([]*model.AccessToken, error) {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	query := `
+	SELECT 
+	personal_access_token.tokenId,
+	personal_access_token.name,
+	personal_access_token.scopes,
+	personal_access_token.createdAt,
+	personal_access_token.expiresAt,
+	personal_access_token.lastUsedAt
+	FROM personal_access_token
+	INNER JOIN user_incidental ON user_incidental.id = personal_access_token.id
+	WHERE user_incidental.uid = ? 
+	ORDER BY personal_access_token.createdAt
+	`
+
+	rows, err := config.DB.Query(query, uid)
+	if err != nil {
+		return nil, fmt.Errorf("user_utils FetchAccessTokens Query: %v", err)
+	}
+	defer rows.Close()
+
+	tokens := []*model.AccessToken{}
+	for rows.Next() {
+		var (
+			token      model.AccessToken
+			scopes     string
+			lastUsedAt sql.NullString
+		)
+		err := rows.Scan(
+			&token.TokenId,
+			&token.Name,
+			&scopes,
+			&token.CreatedAt,
+			&token.ExpiresAt,
+			&lastUsedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("user_utils FetchAccessTokens Scan: %v", err)
+		}
+		token.Scopes = splitScopes(scopes)
+		token.LastUsedAt = lastUsedAt.String
+		tokens = append(tokens, &token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("user_utils FetchAccessTokens rows: %v", err)
+	}
+
+	return tokens, nil
+}
+
+// FetchAccessTokenByHash 按哈希查找令牌，不存在时 uid 为空；账号申请删除后令牌按已过期处理
+func FetchAccessTokenByHash(tokenHash string) (string, *model.AccessToken, bool, error) {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	query := `
+	SELECT 
+	user_incidental.uid,
+	personal_access_token.tokenId,
+	personal_access_token.name,
+	personal_access_token.scopes,
+	(personal_access_token.expiresAt <= NOW() OR user.deleteAfter IS NOT NULL) AS expired
+	FROM personal_access_token
+	INNER JOIN user_incidental ON user_incidental.id = personal_access_token.id
+	INNER JOIN user ON user.id = personal_access_token.id
+	WHERE personal_access_token.tokenHash = ? 
+	`
+
+	var (
+		uid     string
+		token   model.AccessToken
+		scopes  string
+		expired bool
+	)
+	err := config.DB.QueryRow(query, tokenHash).Scan(&uid, &token.TokenId, &token.Name, &scopes, &expired)
+	if err == sql.ErrNoRows {
+		return "", nil, false, nil
+	}
+	if err != nil {
+		return "", nil, false, fmt.Errorf("user_utils FetchAccessTokenByHash QueryRow: %v", err)
+	}
+	token.Scopes = splitScopes(scopes)
+
+	return uid, &token, expired, nil
+}
+
+func TouchAccessToken(tokenId string) error {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	query := `
+	UPDATE personal_access_token
+	SET lastUsedAt = NOW()
+	WHERE personal_access_token.tokenId = ? 
+	`
+
+	if _, err := config.DB.Exec(query, tokenId); err != nil {
+		return fmt.Errorf("user_utils TouchAccessToken Exec: %v", err)
+	}
+	return nil
+}
+
+// DeleteAccessToken 只能删除自己的令牌，返回是否删除了记录
+func DeleteAccessToken(uid string, tokenId string) (bool, error) {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	query := `
+	DELETE personal_access_token
+	FROM personal_access_token
+	INNER JOIN user_incidental ON user_incidental.id = personal_access_token.id
+	WHERE user_incidental.uid = ? 
+	AND personal_access_token.tokenId = ? 
+	`
+
+	result, err := config.DB.Exec(query, uid, tokenId)
+	if err != nil {
+		return false, fmt.Errorf("user_utils DeleteAccessToken Exec: %v", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("user_utils DeleteAccessToken RowsAffected: %v", err)
+	}
+	return affected > 0, nil
+}
@@ -0,0 +1,317 @@
+package user_utils
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/yux77yux/blog-backend/config"
+	"github.com/yux77yux/blog-backend/internal/model"
+)
+
+// AddMedia 记录上传的对象，删除账号时据此清理 OSS
+func AddMedia(uid string, objectName string, kind string) error {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	id, _, err := userIDByUid(uid)
+	if err != nil {
+		return fmt.Errorf("user_utils AddMedia %v", err)
+	}
+
+	query := `
+	INSERT INTO user_media (objectName, id, kind, createdAt) VALUES
+	(?, ?, ?, NOW())
+	ON DUPLICATE KEY UPDATE createdAt = NOW()
+	`
+
+	if _, err := config.DB.Exec(query, objectName, id, kind); err != nil {
+		return fmt.Errorf("user_utils AddMedia Exec: %v", err)
+	}
+	return nil
+}
+
+func FetchMedia(uid string) ([]*model.Media, error) {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	query := `
+	SELECT 
+	user_media.objectName,
+	user_media.kind,
+	user_media.createdAt
+	FROM user_media
+	INNER JOIN user_incidental ON user_incidental.id = user_media.id
+	WHERE user_incidental.uid = ? 
+	ORDER BY user_media.createdAt
+	`
+
+	rows, err := config.DB.Query(query, uid)
+	if err != nil {
+		return nil, fmt.Errorf("user_utils FetchMedia Query: %v", err)
+	}
+	defer rows.Close()
+
+	media := []*model.Media{}
+	for rows.Next() {
+		var item model.Media
+		if err := rows.Scan(&item.ObjectName, &item.Kind, &item.CreatedAt); err != nil {
+			return nil, fmt.Errorf("user_utils FetchMedia Scan: %v", err)
+		}
+		media = append(media, &item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("user_utils FetchMedia rows: %v", err)
+	}
+
+	return media, nil
+}
+
+func FetchAccount(uid string) (*model.AccountInfo, error) {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	query := `
+	SELECT 
+	user.username,
+	user.email,
+	user.pendingEmail,
+	user.deleteAfter
+	FROM user
+	INNER JOIN user_incidental ON user_incidental.id = user.id
+	WHERE user_incidental.uid = ? 
+	`
+
+	var (
+		account                          = model.AccountInfo{Uid: uid}
+		email, pendingEmail, deleteAfter sql.NullString
+	)
+	err := config.DB.QueryRow(query, uid).Scan(&account.Username, &email, &pendingEmail, &deleteAfter)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user_utils FetchAccount QueryRow: user not found")
+		}
+		return nil, fmt.Errorf("user_utils FetchAccount QueryRow: %v", err)
+	}
+	account.Email = email.String
+	account.PendingEmail = pendingEmail.String
+	account.DeleteAfter = deleteAfter.String
+
+	return &account, nil
+}
+
+// FetchArticlesByUid 返回作者的全部文章（包括草稿），用于数据导出
+func FetchArticlesByUid(uid string) ([]*model.Article, error) {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	query := `
+	SELECT 
+	uuid, uid, title, titleLight, coverDimensions, coverImageUrl, summary, content,
+	createdAt, updatedAt, timezone, views, likes, tags, status, popularity
+	FROM article
+	WHERE article.uid = ? 
+	ORDER BY createdAt
+	`
+
+	rows, err := config.DB.Query(query, uid)
+	if err != nil {
+		return nil, fmt.Errorf("user_utils FetchArticlesByUid Query: %v", err)
+	}
+	defer rows.Close()
+
+	articles := []*model.Article{}
+	for rows.Next() {
+		var (
+			article model.Article
+			tags    sql.NullString
+		)
+		err := rows.Scan(
+			&article.Uuid,
+			&article.Uid,
+			&article.Title,
+			&article.TitleLight,
+			&article.CoverDimensions,
+			&article.CoverImageUrl,
+			&article.Summary,
+			&article.Content,
+			&article.CreatedAt,
+			&article.UpdatedAt,
+			&article.Timezone,
+			&article.Views,
+			&article.Likes,
+			&tags,
+			&article.Status,
+			&article.Popularity,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("user_utils FetchArticlesByUid Scan: %v", err)
+		}
+		article.Tags = tags.String
+		articles = append(articles, &article)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("user_utils FetchArticlesByUid rows: %v", err)
+	}
+
+	return articles, nil
+}
+
+// FetchCoverUrls 返回作者文章使用的封面地址，不包括同时被其他用户文章引用的
+func FetchCoverUrls(uid string) ([]string, error) {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	query := `
+	SELECT DISTINCT article.coverImageUrl
+	FROM article
+	WHERE article.uid = ? 
+	AND article.coverImageUrl <> ''
+	AND NOT EXISTS (
+	SELECT 1 FROM article AS other
+	WHERE other.coverImageUrl = article.coverImageUrl
+	AND other.uid <> article.uid)
+	`
+
+	rows, err := config.DB.Query(query, uid)
+	if err != nil {
+		return nil, fmt.Errorf("user_utils FetchCoverUrls Query: %v", err)
+	}
+	defer rows.Close()
+
+	urls := []string{}
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, fmt.Errorf("user_utils FetchCoverUrls Scan: %v", err)
+		}
+		urls = append(urls, url)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("user_utils FetchCoverUrls rows: %v", err)
+	}
+
+	return urls, nil
+}
+
+// ScheduleDeletion 记录删除时间，返回计划删除的时间；已申请过时保留原来的时间
+func ScheduleDeletion(uid string, graceDays int) (string, error) {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	query := `
+	UPDATE user
+	INNER JOIN user_incidental ON user_incidental.id = user.id
+	SET user.deleteAfter = IFNULL(user.deleteAfter, DATE_ADD(NOW(), INTERVAL ? DAY))
+	WHERE user_incidental.uid = ? 
+	`
+
+	if _, err := config.DB.Exec(query, graceDays, uid); err != nil {
+		return "", fmt.Errorf("user_utils ScheduleDeletion Exec: %v", err)
+	}
+
+	query = `
+	SELECT user.deleteAfter
+	FROM user
+	INNER JOIN user_incidental ON user_incidental.id = user.id
+	WHERE user_incidental.uid = ? 
+	`
+
+	var deleteAfter sql.NullString
+	if err := config.DB.QueryRow(query, uid).Scan(&deleteAfter); err != nil {
+		return "", fmt.Errorf("user_utils ScheduleDeletion QueryRow: %v", err)
+	}
+	return deleteAfter.String, nil
+}
+
+// CancelDeletion 返回是否确实撤销了一次删除申请
+func CancelDeletion(uid string) (bool, error) {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	query := `
+	UPDATE user
+	INNER JOIN user_incidental ON user_incidental.id = user.id
+	SET user.deleteAfter = NULL
+	WHERE user_incidental.uid = ? 
+	AND user.deleteAfter IS NOT NULL
+	`
+
+	result, err := config.DB.Exec(query, uid)
+	if err != nil {
+		return false, fmt.Errorf("user_utils CancelDeletion Exec: %v", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("user_utils CancelDeletion RowsAffected: %v", err)
+	}
+	return affected > 0, nil
+}
+
+// FetchDueDeletions 返回宽限期已过、等待清除的 uid
+func FetchDueDeletions() ([]string, error) {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	query := `
+	SELECT user_incidental.uid
+	FROM user
+	INNER JOIN user_incidental ON user_incidental.id = user.id
+	WHERE user.deleteAfter <= NOW()
+	`
+
+	rows, err := config.DB.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("user_utils FetchDueDeletions Query: %v", err)
+	}
+	defer rows.Close()
+
+	uids := []string{}
+	for rows.Next() {
+		var uid string
+		if err := rows.Scan(&uid); err != nil {
+			return nil, fmt.Errorf("user_utils FetchDueDeletions Scan: %v", err)
+		}
+		uids = append(uids, uid)
+	}
+	return uids, rows.Err()
+}
+
+// PurgeUser 删除用户的全部数据库记录；挂在 user 上的其他表通过外键级联删除
+func PurgeUser(uid string) error {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	id, _, err := userIDByUid(uid)
+	if err != nil {
+		return fmt.Errorf("user_utils PurgeUser %v", err)
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("user_utils PurgeUser Begin: %v", err)
+	}
+
+	// 文章和 user_incidental 的外键是 restrict，需要按顺序先删
+	queries := []string{
+		`DELETE FROM article WHERE article.uid = ? `,
+		`DELETE FROM user_incidental WHERE user_incidental.uid = ? `,
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query, uid); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("user_utils PurgeUser Exec: %v", err)
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM user WHERE user.id = ? `, id); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("user_utils PurgeUser Exec: %v", err)
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("user_utils PurgeUser Commit: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package user_utils
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/yux77yux/blog-backend/config"
+)
+
+var (
+	ErrEmailInvalid = errors.New("email address is invalid")
+	ErrEmailTaken   = errors.New("email address is already in use")
+	// 待验证的邮箱已被替换或已验证过
+	ErrEmailChanged = errors.New("email verification no longer matches")
+)
+
+// NormalizeEmail 统一大小写与首尾空白，作为比较与存储的形式
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// ValidateEmail 只接受裸地址（不带显示名），返回规范化后的邮箱
+func ValidateEmail(email string) (string, error) {
+	email = NormalizeEmail(email)
+	if len(email) > 254 {
+		return "", ErrEmailInvalid
+	}
+
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || address.Name != "" {
+		return "", ErrEmailInvalid
+	}
+	return email, nil
+}
+
+// FetchEmail 返回已验证的邮箱和待验证的邮箱
+func FetchEmail(uid string) (string, string, error) {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	query := `
+	SELECT 
+	user.email AS email,
+	user.pendingEmail AS pendingEmail
+	FROM user
+	INNER JOIN user_incidental ON user_incidental.id = user.id
+	WHERE user_incidental.uid = ? 
+	`
+
+	var email, pendingEmail sql.NullString
+	err := config.DB.QueryRow(query, uid).Scan(&email, &pendingEmail)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", "", fmt.Errorf("user_utils FetchEmail QueryRow: user not found")
+		}
+		return "", "", fmt.Errorf("user_utils FetchEmail QueryRow: %v", err)
+	}
+	return email.String, pendingEmail.String, nil
+}
+
+// SetPendingEmail 记录待验证的新邮箱，已验证的旧邮箱在验证通过前保持不变
+func SetPendingEmail(uid string, email string) (string, error) {
+	email, err := ValidateEmail(email)
+	if err != nil {
+		return "", fmt.Errorf("user_utils SetPendingEmail: %w", err)
+	}
+
+	config.OpenDB()
+	defer config.DB.Close()
+
+	// 提前检查，避免给已被占用的地址发送验证邮件
+	query := `
+	SELECT COUNT(*)
+	FROM user
+	WHERE user.email = ? 
+	`
+
+	var count int
+	if err := config.DB.QueryRow(query, email).Scan(&count); err != nil {
+		return "", fmt.Errorf("user_utils SetPendingEmail QueryRow: %v", err)
+	}
+	if count > 0 {
+		return "", fmt.Errorf("user_utils SetPendingEmail: %w", ErrEmailTaken)
+	}
+
+	query = `
+	UPDATE user
+	INNER JOIN user_incidental ON user_incidental.id = user.id
+	SET user.pendingEmail = ?
+	WHERE user_incidental.uid = ? 
+	`
+
+	if _, err := config.DB.Exec(query, email, uid); err != nil {
+		return "", fmt.Errorf("user_utils SetPendingEmail Exec: %v", err)
+	}
+	return email, nil
+}
+
+// ConfirmEmail 把仍与链接一致的待验证邮箱转为已验证
+func ConfirmEmail(uid string, email string) error {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	query := `
+	UPDATE user
+	INNER JOIN user_incidental ON user_incidental.id = user.id
+	SET user.email = user.pendingEmail, user.pendingEmail = NULL
+	WHERE user_incidental.uid = ? 
+	AND user.pendingEmail = ? 
+	`
+
+	result, err := config.DB.Exec(query, uid, email)
+	if err != nil {
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
+			return fmt.Errorf("user_utils ConfirmEmail Exec: %w", ErrEmailTaken)
+		}
+		return fmt.Errorf("user_utils ConfirmEmail Exec: %v", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("user_utils ConfirmEmail RowsAffected: %v", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("user_utils ConfirmEmail: %w", ErrEmailChanged)
+	}
+	return nil
+}
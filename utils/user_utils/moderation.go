@@ -0,0 +1,94 @@
+package user_utils
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/yux77yux/blog-backend/config"
+	"github.com/yux77yux/blog-backend/internal/model"
+)
+
+// user.status 的取值
+const (
+	AccountActive    = 0
+	AccountSuspended = 1
+	AccountBanned    = 2
+)
+
+var accountStates = map[int]string{
+	AccountActive:    "active",
+	AccountSuspended: "suspended",
+	AccountBanned:    "banned",
+}
+
+// SetAccountState 修改账号状态，hours 大于 0 时记录暂停到期时间
+func SetAccountState(uid string, state int, hours int, reason string, hideContent bool) error {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	if _, _, err := userIDByUid(uid); err != nil {
+		return fmt.Errorf("user_utils SetAccountState %v", err)
+	}
+
+	query := `
+	UPDATE user
+	INNER JOIN user_incidental ON user_incidental.id = user.id
+	SET user.status = ?,
+	user.suspendedUntil = IF(? > 0, DATE_ADD(NOW(), INTERVAL ? HOUR), NULL),
+	user.statusReason = ?,
+	user.contentHidden = ?
+	WHERE user_incidental.uid = ? 
+	`
+
+	_, err := config.DB.Exec(query, state, hours, hours, reason, hideContent, uid)
+	if err != nil {
+		return fmt.Errorf("user_utils SetAccountState Exec: %v", err)
+	}
+	return nil
+}
+
+// FetchAccountStatus 暂停已到期的账号按 active 返回
+func FetchAccountStatus(uid string) (*model.AccountStatus, error) {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	query := `
+	SELECT 
+	user.status,
+	user.suspendedUntil,
+	user.statusReason,
+	user.contentHidden,
+	IFNULL(user.suspendedUntil <= NOW(), 0) AS expired
+	FROM user
+	INNER JOIN user_incidental ON user_incidental.id = user.id
+	WHERE user_incidental.uid = ? 
+	`
+
+	var (
+		state   int
+		until   sql.NullString
+		reason  sql.NullString
+		status  = model.AccountStatus{Uid: uid}
+		expired bool
+	)
+	err := config.DB.QueryRow(query, uid).Scan(&state, &until, &reason, &status.ContentHidden, &expired)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user_utils FetchAccountStatus QueryRow: user not found")
+		}
+		return nil, fmt.Errorf("user_utils FetchAccountStatus QueryRow: %v", err)
+	}
+
+	// 暂停到期后隐藏随之失效
+	if state == AccountSuspended && expired {
+		state = AccountActive
+		status.ContentHidden = false
+	}
+	status.State = accountStates[state]
+	status.Reason = reason.String
+	if state == AccountSuspended {
+		status.Until = until.String
+	}
+
+	return &status, nil
+}
@@ -0,0 +1,134 @@
+package user_utils
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/yux77yux/blog-backend/config"
+	"github.com/yux77yux/blog-backend/internal/model"
+)
+
+func scanPasskeys(rows *sql.Rows) ([]*model.Passkey, error) {
+	passkeys := []*model.Passkey{}
+	for rows.Next() {
+		var (
+			passkey    model.Passkey
+			lastUsedAt sql.NullString
+		)
+		err := rows.Scan(
+			&passkey.CredentialId,
+			&passkey.Name,
+			&passkey.Credential,
+			&passkey.SignCount,
+			&passkey.CreatedAt,
+			&lastUsedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		passkey.LastUsedAt = lastUsedAt.String
+		passkeys = append(passkeys, &passkey)
+	}
+	return passkeys, rows.Err()
+}
+
+// FetchPasskeys 返回用户名及该用户登记的全部通行密钥
+func FetchPasskeys(uid string) (string, []*model.Passkey, error) {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	id, username, err := userIDByUid(uid)
+	if err != nil {
+		return "", nil, fmt.Errorf("user_utils FetchPasskeys %v", err)
+	}
+
+	query := `
+	SELECT 
+	credentialId, name, credential, signCount, createdAt, lastUsedAt
+	FROM webauthn_credential
+	WHERE webauthn_credential.id = ? 
+	ORDER BY createdAt
+	`
+
+	rows, err := config.DB.Query(query, id)
+	if err != nil {
+		return "", nil, fmt.Errorf("user_utils FetchPasskeys Query: %v", err)
+	}
+	defer rows.Close()
+
+	passkeys, err := scanPasskeys(rows)
+	if err != nil {
+		return "", nil, fmt.Errorf("user_utils FetchPasskeys Scan: %v", err)
+	}
+
+	return username, passkeys, nil
+}
+
+func AddPasskey(uid string, passkey *model.Passkey) error {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	id, _, err := userIDByUid(uid)
+	if err != nil {
+		return fmt.Errorf("user_utils AddPasskey %v", err)
+	}
+
+	query := `
+	INSERT INTO webauthn_credential (credentialId, id, name, credential, signCount, createdAt) VALUES
+	(?, ?, ?, ?, ?, NOW())
+	`
+
+	_, err = config.DB.Exec(query, passkey.CredentialId, id, passkey.Name, passkey.Credential, passkey.SignCount)
+	if err != nil {
+		return fmt.Errorf("user_utils AddPasskey Exec: %v", err)
+	}
+	return nil
+}
+
+// UpdatePasskeySignCount 登录成功后记录新的签名计数
+func UpdatePasskeySignCount(credentialId string, signCount uint32) error {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	query := `
+	UPDATE webauthn_credential
+	SET signCount = ?, lastUsedAt = NOW()
+	WHERE webauthn_credential.credentialId = ? 
+	`
+
+	_, err := config.DB.Exec(query, signCount, credentialId)
+	if err != nil {
+		return fmt.Errorf("user_utils UpdatePasskeySignCount Exec: %v", err)
+	}
+	return nil
+}
+
+func DeletePasskey(uid string, credentialId string) error {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	id, _, err := userIDByUid(uid)
+	if err != nil {
+		return fmt.Errorf("user_utils DeletePasskey %v", err)
+	}
+
+	query := `
+	DELETE FROM webauthn_credential
+	WHERE webauthn_credential.id = ? 
+	AND webauthn_credential.credentialId = ? 
+	`
+
+	result, err := config.DB.Exec(query, id, credentialId)
+	if err != nil {
+		return fmt.Errorf("user_utils DeletePasskey Exec: %v", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("user_utils DeletePasskey RowsAffected: %v", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("user_utils DeletePasskey: passkey not found")
+	}
+	return nil
+}
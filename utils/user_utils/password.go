@@ -0,0 +1,112 @@
+package user_utils
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/yux77yux/blog-backend/config"
+	"github.com/yux77yux/blog-backend/utils/password_utils"
+	"github.com/yux77yux/blog-backend/utils/policy_utils"
+)
+
+// CheckPassword 校验用户当前的密码
+func CheckPassword(uid string, password string) (bool, error) {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	query := `
+	SELECT 
+	user.password AS password
+	FROM user
+	INNER JOIN user_incidental ON user_incidental.id = user.id
+	WHERE user_incidental.uid = ? 
+	`
+
+	var encoded string
+	err := config.DB.QueryRow(query, uid).Scan(&encoded)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, fmt.Errorf("user_utils CheckPassword QueryRow: user not found")
+		}
+		return false, fmt.Errorf("user_utils CheckPassword QueryRow: %v", err)
+	}
+
+	matched, err := password_utils.Verify(encoded, password)
+	if err != nil {
+		return false, fmt.Errorf("user_utils CheckPassword Verify: %v", err)
+	}
+	return matched, nil
+}
+
+// UpdatePassword 按密码策略校验新密码后写入哈希
+func UpdatePassword(uid string, password string) error {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	_, username, err := userIDByUid(uid)
+	if err != nil {
+		return fmt.Errorf("user_utils UpdatePassword: %v", err)
+	}
+
+	if err := policy_utils.ValidatePassword(password, username); err != nil {
+		return fmt.Errorf("user_utils UpdatePassword: %w", err)
+	}
+
+	hashed, err := password_utils.Hash(password)
+	if err != nil {
+		return fmt.Errorf("user_utils UpdatePassword Hash: %v", err)
+	}
+
+	query := `
+	UPDATE user
+	INNER JOIN user_incidental ON user_incidental.id = user.id
+	SET user.password = ?
+	WHERE user_incidental.uid = ? 
+	`
+
+	_, err = config.DB.Exec(query, hashed, uid)
+	if err != nil {
+		return fmt.Errorf("user_utils UpdatePassword Exec: %v", err)
+	}
+	return nil
+}
+
+// FetchUsername 返回 uid 对应的用户名，用于在修改密码前检查密码策略
+func FetchUsername(uid string) (string, error) {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	_, username, err := userIDByUid(uid)
+	if err != nil {
+		return "", fmt.Errorf("user_utils FetchUsername: %v", err)
+	}
+	return username, nil
+}
+
+// FetchEmailByUsername 返回找回密码邮件的收件地址，username 也可以是已验证的邮箱；未验证邮箱时 email 为空
+func FetchEmailByUsername(username string) (string, string, error) {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	where, args := loginCondition(username)
+	query := `
+	SELECT 
+	user_incidental.uid AS uid,
+	user.email AS email
+	FROM user
+	INNER JOIN user_incidental ON user_incidental.id = user.id
+	` + where
+
+	var (
+		uid   string
+		email sql.NullString
+	)
+	err := config.DB.QueryRow(query, args...).Scan(&uid, &email)
+	if err == sql.ErrNoRows {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("user_utils FetchEmailByUsername QueryRow: %v", err)
+	}
+	return uid, email.String, nil
+}
@@ -0,0 +1,117 @@
+package user_utils
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/yux77yux/blog-backend/config"
+	"github.com/yux77yux/blog-backend/internal/model"
+)
+
+// AddSignInLocation 记录一次登录位置，并清理超过 keep 的旧记录
+func AddSignInLocation(uid string, location *model.SignInLocation, keep time.Duration) error {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	id, _, err := userIDByUid(uid)
+	if err != nil {
+		return fmt.Errorf("user_utils AddSignInLocation: %v", err)
+	}
+
+	now := time.Now()
+	query := `
+	INSERT INTO sign_in_location (id, ip, country, region, city, asn, latitude, longitude, createdAt) VALUES
+	(?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err = config.DB.Exec(query,
+		id,
+		location.IP,
+		location.Country,
+		location.Region,
+		location.City,
+		location.ASN,
+		location.Latitude,
+		location.Longitude,
+		now,
+	)
+	if err != nil {
+		return fmt.Errorf("user_utils AddSignInLocation Exec: %v", err)
+	}
+
+	query = `
+	DELETE FROM sign_in_location
+	WHERE sign_in_location.id = ? 
+	AND sign_in_location.createdAt < ?
+	`
+	_, err = config.DB.Exec(query, id, now.Add(-keep))
+	if err != nil {
+		return fmt.Errorf("user_utils AddSignInLocation Exec: %v", err)
+	}
+
+	return nil
+}
+
+// FetchSignInLocations 返回 within 之内的登录位置，最近的在前
+func FetchSignInLocations(uid string, within time.Duration, limit int) ([]*model.SignInLocation, error) {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	query := `
+	SELECT 
+	sign_in_location.ip,
+	sign_in_location.country,
+	sign_in_location.region,
+	sign_in_location.city,
+	sign_in_location.asn,
+	sign_in_location.latitude,
+	sign_in_location.longitude,
+	sign_in_location.createdAt,
+	TIMESTAMPDIFF(SECOND, sign_in_location.createdAt, ?) AS secondsAgo
+	FROM sign_in_location
+	INNER JOIN user_incidental ON user_incidental.id = sign_in_location.id
+	WHERE user_incidental.uid = ? 
+	AND sign_in_location.createdAt >= ?
+	ORDER BY sign_in_location.createdAt DESC
+	LIMIT ?
+	`
+
+	now := time.Now()
+	rows, err := config.DB.Query(query, now, uid, now.Add(-within), limit)
+	if err != nil {
+		return nil, fmt.Errorf("user_utils FetchSignInLocations Query: %v", err)
+	}
+	defer rows.Close()
+
+	locations := []*model.SignInLocation{}
+	for rows.Next() {
+		var (
+			location            model.SignInLocation
+			latitude, longitude sql.NullFloat64
+		)
+		err := rows.Scan(
+			&location.IP,
+			&location.Country,
+			&location.Region,
+			&location.City,
+			&location.ASN,
+			&latitude,
+			&longitude,
+			&location.CreatedAt,
+			&location.SecondsAgo,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("user_utils FetchSignInLocations Scan: %v", err)
+		}
+		if latitude.Valid && longitude.Valid {
+			location.Latitude = &latitude.Float64
+			location.Longitude = &longitude.Float64
+		}
+		locations = append(locations, &location)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("user_utils FetchSignInLocations rows: %v", err)
+	}
+
+	return locations, nil
+}
@@ -0,0 +1,229 @@
+package user_utils
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/yux77yux/blog-backend/config"
+	"github.com/yux77yux/blog-backend/utils/totp_utils"
+)
+
+// 调用前需要已经 OpenDB
+func userIDByUid(uid string) (int64, string, error) {
+	query := `
+	SELECT 
+	user.id AS id,
+	user.username AS username
+	FROM user
+	INNER JOIN user_incidental ON user_incidental.id = user.id
+	WHERE user_incidental.uid = ? 
+	`
+
+	var (
+		id       int64
+		username string
+	)
+	err := config.DB.QueryRow(query, uid).Scan(&id, &username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, "", fmt.Errorf("userIDByUid QueryRow: user not found")
+		}
+		return 0, "", fmt.Errorf("userIDByUid QueryRow: %v", err)
+	}
+	return id, username, nil
+}
+
+// SaveTotpSecret 保存待确认的 TOTP 密钥，返回用户名用于 otpauth 标签
+func SaveTotpSecret(uid string, secret string) (string, error) {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	id, username, err := userIDByUid(uid)
+	if err != nil {
+		return "", fmt.Errorf("user_utils SaveTotpSecret %v", err)
+	}
+
+	query := `
+	INSERT INTO user_totp (id, secret, enabled, createdAt) VALUES
+	(?, ?, 0, NOW())
+	ON DUPLICATE KEY UPDATE
+	secret = IF(enabled = 1, secret, VALUES(secret)),
+	createdAt = IF(enabled = 1, createdAt, VALUES(createdAt))
+	`
+
+	result, err := config.DB.Exec(query, id, secret)
+	if err != nil {
+		return "", fmt.Errorf("user_utils SaveTotpSecret Exec: %v", err)
+	}
+
+	// 已启用时上面的语句不会改动任何行
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("user_utils SaveTotpSecret RowsAffected: %v", err)
+	}
+	if affected == 0 {
+		return "", fmt.Errorf("user_utils SaveTotpSecret: two-factor authentication is already enabled")
+	}
+
+	return username, nil
+}
+
+// GetTotp 返回用户的 TOTP 密钥，未登记时 secret 为空
+func GetTotp(uid string) (string, bool, error) {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	query := `
+	SELECT 
+	user_totp.secret AS secret,
+	user_totp.enabled AS enabled
+	FROM user_totp
+	INNER JOIN user_incidental ON user_incidental.id = user_totp.id
+	WHERE user_incidental.uid = ? 
+	`
+
+	var (
+		secret  string
+		enabled bool
+	)
+	err := config.DB.QueryRow(query, uid).Scan(&secret, &enabled)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("user_utils GetTotp QueryRow: %v", err)
+	}
+	return secret, enabled, nil
+}
+
+func IsTotpEnabled(uid string) (bool, error) {
+	_, enabled, err := GetTotp(uid)
+	return enabled, err
+}
+
+// EnableTotp 启用两步验证，并用新的恢复码替换旧的
+func EnableTotp(uid string, recoveryCodes []string) error {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	id, _, err := userIDByUid(uid)
+	if err != nil {
+		return fmt.Errorf("user_utils EnableTotp %v", err)
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("user_utils EnableTotp Begin: %v", err)
+	}
+
+	query := `
+	UPDATE user_totp
+	SET enabled = 1
+	WHERE user_totp.id = ? 
+	`
+	if _, err = tx.Exec(query, id); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("user_utils EnableTotp Exec: %v", err)
+	}
+
+	if err = replaceRecoveryCodes(tx, id, recoveryCodes); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("user_utils EnableTotp %v", err)
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("user_utils EnableTotp Commit: %v", err)
+	}
+
+	return nil
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, id int64, recoveryCodes []string) error {
+	query := `
+	DELETE FROM user_recovery_code
+	WHERE user_recovery_code.id = ? 
+	`
+	if _, err := tx.Exec(query, id); err != nil {
+		return fmt.Errorf("replaceRecoveryCodes Exec: %v", err)
+	}
+
+	query = `
+	INSERT INTO user_recovery_code (id, codeHash) VALUES
+	(?, ?)
+	`
+	for _, code := range recoveryCodes {
+		if _, err := tx.Exec(query, id, totp_utils.HashRecoveryCode(code)); err != nil {
+			return fmt.Errorf("replaceRecoveryCodes Exec: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func DisableTotp(uid string) error {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	id, _, err := userIDByUid(uid)
+	if err != nil {
+		return fmt.Errorf("user_utils DisableTotp %v", err)
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("user_utils DisableTotp Begin: %v", err)
+	}
+
+	if err = replaceRecoveryCodes(tx, id, nil); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("user_utils DisableTotp %v", err)
+	}
+
+	query := `
+	DELETE FROM user_totp
+	WHERE user_totp.id = ? 
+	`
+	if _, err = tx.Exec(query, id); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("user_utils DisableTotp Exec: %v", err)
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("user_utils DisableTotp Commit: %v", err)
+	}
+
+	return nil
+}
+
+// UseRecoveryCode 核销一个恢复码，每个码只能成功一次
+func UseRecoveryCode(uid string, code string) (bool, error) {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	id, _, err := userIDByUid(uid)
+	if err != nil {
+		return false, fmt.Errorf("user_utils UseRecoveryCode %v", err)
+	}
+
+	query := `
+	UPDATE user_recovery_code
+	SET usedAt = NOW()
+	WHERE user_recovery_code.id = ? 
+	AND user_recovery_code.codeHash = ? 
+	AND user_recovery_code.usedAt IS NULL
+	LIMIT 1
+	`
+
+	result, err := config.DB.Exec(query, id, totp_utils.HashRecoveryCode(code))
+	if err != nil {
+		return false, fmt.Errorf("user_utils UseRecoveryCode Exec: %v", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("user_utils UseRecoveryCode RowsAffected: %v", err)
+	}
+	return affected == 1, nil
+}
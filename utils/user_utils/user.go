@@ -2,52 +2,94 @@ package user_utils
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
-	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-sql-driver/mysql"
 	"github.com/yux77yux/blog-backend/config"
 	"github.com/yux77yux/blog-backend/internal/model"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+	"github.com/yux77yux/blog-backend/utils/password_utils"
+	"github.com/yux77yux/blog-backend/utils/policy_utils"
+	"github.com/yux77yux/blog-backend/utils/rbac_utils"
 	"github.com/yux77yux/blog-backend/utils/redis_utils"
 )
 
+// 用户名不存在与密码错误返回同一个错误
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// 包含 @ 时优先匹配已验证的邮箱，没有匹配的邮箱再按用户名查找，兼容带 @ 的旧用户名
+func loginCondition(login string) (string, []interface{}) {
+	if !strings.Contains(login, "@") {
+		return `WHERE user.username = ? `, []interface{}{login}
+	}
+
+	email := NormalizeEmail(login)
+	where := `
+	WHERE user.email = ? OR user.username = ?
+	ORDER BY user.email = ? DESC
+	LIMIT 1
+	`
+	return where, []interface{}{email, login, email}
+}
+
 func SignIn(user model.UsernameAndPassword) (*model.UserIncidental, error) {
 	config.OpenDB()
 	defer config.DB.Close()
 
+	where, args := loginCondition(user.Username)
 	query := `
 	SELECT 
+	user.id AS id,
+	user.password AS password,
 	user_incidental.uid AS uid
 	FROM user
 	INNER JOIN user_incidental ON user_incidental.id = user.id
-	WHERE user.username = ? 
-	AND user.password = ? 
-	`
+	` + where
 
-	var uid string
-	err := config.DB.QueryRow(query, user.Username, user.Password).Scan(
+	var (
+		id      int64
+		encoded string
+		uid     string
+	)
+	err := config.DB.QueryRow(query, args...).Scan(
+		&id,
+		&encoded,
 		&uid,
 	)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("user_utils SignIn QueryRow: user not found")
+			password_utils.VerifyDummy(user.Password)
+			return nil, fmt.Errorf("user_utils SignIn QueryRow: %w", ErrInvalidCredentials)
 		}
-		return nil, fmt.Errorf("user_utils SignIn QueryRow: user not found %v", err)
+		return nil, fmt.Errorf("user_utils SignIn QueryRow: %v", err)
 	}
 
-	err = redis_utils.SetUserOnline(uid, true)
+	matched, err := password_utils.Verify(encoded, user.Password)
 	if err != nil {
-		return nil, fmt.Errorf("user_utils SetUserOnline: setUserOnline failure %v", err)
+		return nil, fmt.Errorf("user_utils SignIn Verify: %v", err)
+	}
+	if !matched {
+		return nil, fmt.Errorf("user_utils SignIn Verify: %w", ErrInvalidCredentials)
 	}
 
+	// 旧的明文或低强度哈希，登录成功后顺便升级
+	if password_utils.NeedsRehash(encoded) {
+		if err := rehashPassword(id, user.Password); err != nil {
+			log_utils.Logger.Printf("Error: user_utils SignIn rehashPassword: %v", err)
+		}
+	}
+
+	// 在线状态由签发 token 的一方设置，开启两步验证时要等第二步通过
 	var currentUser *model.UserIncidental
 	currentUser, err = redis_utils.GetUserFromRedis(uid)
 	if err != nil {
 		currentUser, err = FetchUser(uid)
 		if err != nil {
-			_ = redis_utils.SetUserOnline(uid, false)
 			return nil, fmt.Errorf("user_utils FetchLatestUser: fetchLatestUser failure %v", err)
 		}
 
@@ -57,16 +99,47 @@ func SignIn(user model.UsernameAndPassword) (*model.UserIncidental, error) {
 	return currentUser, nil
 }
 
-func AddUser(user model.UsernameAndPassword) error {
-	pattern := `^[A-Za-z!@#$%^&*()_+={}\[\]:;"'<>,.?/]+([A-Za-z0-9!@#$%^&*()_+={}\[\]:;"'<>,.?/]){7,}$`
-	re, err := regexp.Compile(pattern)
+// FetchUidByLogin 按用户名或已验证的邮箱查找 uid，不存在时返回空字符串
+func FetchUidByLogin(login string) (string, error) {
+	config.OpenDB()
+	defer config.DB.Close()
+
+	where, args := loginCondition(login)
+	query := `
+	SELECT user_incidental.uid
+	FROM user
+	INNER JOIN user_incidental ON user_incidental.id = user.id
+	` + where
+
+	var uid string
+	err := config.DB.QueryRow(query, args...).Scan(&uid)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
 	if err != nil {
-		return err
+		return "", fmt.Errorf("user_utils FetchUidByLogin QueryRow: %v", err)
 	}
+	return uid, nil
+}
 
-	matched := re.MatchString(user.Password)
-	if !matched {
-		return fmt.Errorf("user_utils AddUser: password or username not match the rule")
+// AddUser 创建账号并返回 uid，填写的邮箱先记为待验证
+func AddUser(user model.UsernameAndPassword) (string, error) {
+	if err := policy_utils.ValidateSignUp(user.Username, user.Password); err != nil {
+		return "", fmt.Errorf("user_utils AddUser: %w", err)
+	}
+
+	var pendingEmail sql.NullString
+	if user.Email != "" {
+		email, err := ValidateEmail(user.Email)
+		if err != nil {
+			return "", fmt.Errorf("user_utils AddUser: %v", err)
+		}
+		pendingEmail = sql.NullString{String: email, Valid: true}
+	}
+
+	hashed, err := password_utils.Hash(user.Password)
+	if err != nil {
+		return "", fmt.Errorf("user_utils AddUser Hash: %v", err)
 	}
 
 	config.OpenDB()
@@ -74,27 +147,27 @@ func AddUser(user model.UsernameAndPassword) error {
 
 	tx, err := config.DB.Begin()
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	query := `
-	INSERT INTO user (username, password) VALUES
-	(?, ?)
+	INSERT INTO user (username, password, pendingEmail) VALUES
+	(?, ?, ?)
 	`
 
-	result, err := config.DB.Exec(query, user.Username, user.Password)
+	result, err := config.DB.Exec(query, user.Username, hashed, pendingEmail)
 	if err != nil {
 		tx.Rollback()
 		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
-			return fmt.Errorf("user_utils AddUser Exec: 用户名已经存在")
+			return "", fmt.Errorf("user_utils AddUser Exec: 用户名已经存在")
 		}
-		return err
+		return "", err
 	}
 
 	userID, err := result.LastInsertId()
 	if err != nil {
 		tx.Rollback()
-		return fmt.Errorf("user_utils AddUser LastInsertId: %v", err)
+		return "", fmt.Errorf("user_utils AddUser LastInsertId: %v", err)
 	}
 	uid := 100000000 + userID
 	uidStr := strconv.FormatInt(uid, 10)
@@ -105,11 +178,44 @@ func AddUser(user model.UsernameAndPassword) error {
 	_, err = tx.Exec(query, uidStr, userID)
 	if err != nil {
 		tx.Rollback()
-		return fmt.Errorf("user_utils AddUser Exec: %v", err)
+		return "", fmt.Errorf("user_utils AddUser Exec: %v", err)
+	}
+
+	// 新账号默认获得作者角色
+	query = `
+	INSERT INTO user_role (id, roleId, grantedAt)
+	SELECT ?, role.roleId, ?
+	FROM role
+	WHERE role.name = ? 
+	`
+	_, err = tx.Exec(query, userID, time.Now(), rbac_utils.DefaultRole)
+	if err != nil {
+		tx.Rollback()
+		return "", fmt.Errorf("user_utils AddUser Exec: %v", err)
 	}
 
 	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("user_utils AddUser Commit: %v", err)
+		return "", fmt.Errorf("user_utils AddUser Commit: %v", err)
+	}
+
+	return uidStr, nil
+}
+
+func rehashPassword(id int64, password string) error {
+	hashed, err := password_utils.Hash(password)
+	if err != nil {
+		return fmt.Errorf("user_utils rehashPassword Hash: %v", err)
+	}
+
+	query := `
+	UPDATE user
+	SET password = ?
+	WHERE user.id = ? 
+	`
+
+	_, err = config.DB.Exec(query, hashed, id)
+	if err != nil {
+		return fmt.Errorf("user_utils rehashPassword Exec: %v", err)
 	}
 
 	return nil
@@ -0,0 +1,287 @@
+package webauthn_utils
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/yux77yux/blog-backend/internal/model"
+	"github.com/yux77yux/blog-backend/utils/log_utils"
+	"github.com/yux77yux/blog-backend/utils/redis_utils"
+	"github.com/yux77yux/blog-backend/utils/user_utils"
+)
+
+// 注册与登录仪式的有效期
+const ceremonyTTL = time.Minute * 5
+
+var (
+	ErrCeremonyExpired = errors.New("passkey ceremony is invalid or expired")
+	ErrClonedPasskey   = errors.New("passkey sign counter went backwards, the authenticator may be cloned")
+)
+
+var (
+	instance     *webauthn.WebAuthn
+	instanceOnce sync.Once
+	instanceErr  error
+)
+
+func getEnv(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// RP 信息通过 BLOG_WEBAUTHN_RP_ID、BLOG_WEBAUTHN_RP_ORIGINS（逗号分隔）配置
+func getInstance() (*webauthn.WebAuthn, error) {
+	instanceOnce.Do(func() {
+		instance, instanceErr = webauthn.New(&webauthn.Config{
+			RPID:          getEnv("BLOG_WEBAUTHN_RP_ID", "localhost"),
+			RPDisplayName: "Blog",
+			RPOrigins:     strings.Split(getEnv("BLOG_WEBAUTHN_RP_ORIGINS", "http://localhost:3000"), ","),
+		})
+	})
+	return instance, instanceErr
+}
+
+// passkeyUser 实现 webauthn.User，user handle 使用 uid
+type passkeyUser struct {
+	uid         string
+	username    string
+	credentials []webauthn.Credential
+}
+
+func (u *passkeyUser) WebAuthnID() []byte                         { return []byte(u.uid) }
+func (u *passkeyUser) WebAuthnName() string                       { return u.username }
+func (u *passkeyUser) WebAuthnDisplayName() string                { return u.username }
+func (u *passkeyUser) WebAuthnIcon() string                       { return "" }
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential { return u.credentials }
+
+func loadUser(uid string) (*passkeyUser, error) {
+	username, passkeys, err := user_utils.FetchPasskeys(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &passkeyUser{uid: uid, username: username}
+	for _, passkey := range passkeys {
+		var credential webauthn.Credential
+		if err := json.Unmarshal([]byte(passkey.Credential), &credential); err != nil {
+			log_utils.Logger.Printf("Error: webauthn_utils loadUser Unmarshal %s: %v", passkey.CredentialId, err)
+			continue
+		}
+		// 计数以单独的列为准
+		credential.Authenticator.SignCount = passkey.SignCount
+		user.credentials = append(user.credentials, credential)
+	}
+	return user, nil
+}
+
+func storeSession(key string, session *webauthn.SessionData) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return redis_utils.StoreWebauthnSession(key, string(data), ceremonyTTL)
+}
+
+func takeSession(key string) (*webauthn.SessionData, error) {
+	data, err := redis_utils.TakeWebauthnSession(key)
+	if err == redis.Nil {
+		return nil, ErrCeremonyExpired
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func registrationKey(uid string) string {
+	return fmt.Sprintf("register:%s", uid)
+}
+
+func loginKey(sessionId string) string {
+	return fmt.Sprintf("login:%s", sessionId)
+}
+
+// BeginRegistration 生成注册选项，要求可发现凭证以便免用户名登录
+func BeginRegistration(uid string) (*protocol.CredentialCreation, error) {
+	wa, err := getInstance()
+	if err != nil {
+		return nil, fmt.Errorf("webauthn_utils BeginRegistration: %v", err)
+	}
+
+	user, err := loadUser(uid)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn_utils BeginRegistration: %v", err)
+	}
+
+	creation, session, err := beginRegistration(wa, user)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn_utils BeginRegistration: %v", err)
+	}
+
+	if err := storeSession(registrationKey(uid), session); err != nil {
+		return nil, fmt.Errorf("webauthn_utils BeginRegistration storeSession: %v", err)
+	}
+	return creation, nil
+}
+
+// FinishRegistration 校验认证器的 attestation 并保存新凭证
+func FinishRegistration(uid string, name string, body io.Reader) (*model.Passkey, error) {
+	wa, err := getInstance()
+	if err != nil {
+		return nil, fmt.Errorf("webauthn_utils FinishRegistration: %v", err)
+	}
+
+	session, err := takeSession(registrationKey(uid))
+	if err != nil {
+		return nil, fmt.Errorf("webauthn_utils FinishRegistration: %w", err)
+	}
+
+	user, err := loadUser(uid)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn_utils FinishRegistration: %v", err)
+	}
+
+	credential, err := createCredential(wa, user, session, body)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn_utils FinishRegistration %v", err)
+	}
+
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn_utils FinishRegistration Marshal: %v", err)
+	}
+
+	passkey := &model.Passkey{
+		CredentialId: base64.RawURLEncoding.EncodeToString(credential.ID),
+		Name:         name,
+		SignCount:    credential.Authenticator.SignCount,
+		Credential:   string(data),
+	}
+	if err := user_utils.AddPasskey(uid, passkey); err != nil {
+		return nil, fmt.Errorf("webauthn_utils FinishRegistration: %v", err)
+	}
+	return passkey, nil
+}
+
+// BeginLogin 生成可发现凭证的登录选项，返回的 sessionId 需要在 FinishLogin 时带回
+func BeginLogin() (*protocol.CredentialAssertion, string, error) {
+	wa, err := getInstance()
+	if err != nil {
+		return nil, "", fmt.Errorf("webauthn_utils BeginLogin: %v", err)
+	}
+
+	assertion, session, err := beginLogin(wa)
+	if err != nil {
+		return nil, "", fmt.Errorf("webauthn_utils BeginLogin: %v", err)
+	}
+
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return nil, "", fmt.Errorf("webauthn_utils BeginLogin rand.Read: %v", err)
+	}
+	sessionId := base64.RawURLEncoding.EncodeToString(bytes)
+
+	if err := storeSession(loginKey(sessionId), session); err != nil {
+		return nil, "", fmt.Errorf("webauthn_utils BeginLogin storeSession: %v", err)
+	}
+	return assertion, sessionId, nil
+}
+
+// FinishLogin 校验断言并更新签名计数，返回登录用户的 uid
+func FinishLogin(sessionId string, body io.Reader) (string, error) {
+	wa, err := getInstance()
+	if err != nil {
+		return "", fmt.Errorf("webauthn_utils FinishLogin: %v", err)
+	}
+
+	session, err := takeSession(loginKey(sessionId))
+	if err != nil {
+		return "", fmt.Errorf("webauthn_utils FinishLogin: %w", err)
+	}
+
+	user, credential, err := validateLogin(wa, session, body, loadUser)
+	if err != nil {
+		return "", fmt.Errorf("webauthn_utils FinishLogin %w", err)
+	}
+
+	credentialId := base64.RawURLEncoding.EncodeToString(credential.ID)
+	if err := user_utils.UpdatePasskeySignCount(credentialId, credential.Authenticator.SignCount); err != nil {
+		log_utils.Logger.Printf("Error: webauthn_utils FinishLogin: %v", err)
+	}
+
+	return user.uid, nil
+}
+
+// 以下几个函数不依赖 Redis 和数据库，可以直接用软件认证器测试
+
+func beginRegistration(wa *webauthn.WebAuthn, user *passkeyUser) (*protocol.CredentialCreation, *webauthn.SessionData, error) {
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(user.credentials))
+	for _, credential := range user.credentials {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	return wa.BeginRegistration(user,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(exclusions),
+	)
+}
+
+func createCredential(wa *webauthn.WebAuthn, user *passkeyUser, session *webauthn.SessionData, body io.Reader) (*webauthn.Credential, error) {
+	parsed, err := protocol.ParseCredentialCreationResponseBody(body)
+	if err != nil {
+		return nil, fmt.Errorf("createCredential Parse: %v", err)
+	}
+
+	credential, err := wa.CreateCredential(user, *session, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("createCredential CreateCredential: %v", err)
+	}
+	return credential, nil
+}
+
+func beginLogin(wa *webauthn.WebAuthn) (*protocol.CredentialAssertion, *webauthn.SessionData, error) {
+	return wa.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+}
+
+// validateLogin 校验断言，签名计数没有增长时返回 ErrClonedPasskey
+func validateLogin(wa *webauthn.WebAuthn, session *webauthn.SessionData, body io.Reader, load func(uid string) (*passkeyUser, error)) (*passkeyUser, *webauthn.Credential, error) {
+	parsed, err := protocol.ParseCredentialRequestResponseBody(body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("validateLogin Parse: %v", err)
+	}
+
+	var user *passkeyUser
+	credential, err := wa.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+		user, err = load(string(userHandle))
+		return user, err
+	}, *session, parsed)
+	if err != nil {
+		return nil, nil, fmt.Errorf("validateLogin Validate: %v", err)
+	}
+
+	if credential.Authenticator.CloneWarning {
+		log_utils.Logger.Printf("Warning: webauthn_utils cloned passkey suspected for %s", user.uid)
+		return nil, nil, fmt.Errorf("validateLogin: %w", ErrClonedPasskey)
+	}
+	return user, credential, nil
+}
@@ -0,0 +1,234 @@
+package webauthn_utils
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "http://localhost:3000"
+
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+var b64 = base64.RawURLEncoding
+
+// softAuthenticator 在内存中模拟一个 ES256 认证器
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialId []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentialId := make([]byte, 32)
+	if _, err := rand.Read(credentialId); err != nil {
+		t.Fatal(err)
+	}
+	return &softAuthenticator{key: key, credentialId: credentialId}
+}
+
+func (a *softAuthenticator) authenticatorData(flags byte, attested []byte) []byte {
+	rpIdHash := sha256.Sum256([]byte(testRPID))
+	data := append([]byte{}, rpIdHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attested...)
+}
+
+func (a *softAuthenticator) clientData(t *testing.T, kind string, challenge []byte) []byte {
+	data, err := json.Marshal(map[string]string{
+		"type":      kind,
+		"challenge": b64.EncodeToString(challenge),
+		"origin":    testOrigin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// 以 none 格式返回 attestation，公钥为 COSE 编码的 EC2 P-256
+func (a *softAuthenticator) register(t *testing.T, creation *protocol.CredentialCreation) []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.key.PublicKey.X.FillBytes(x)
+	a.key.PublicKey.Y.FillBytes(y)
+	publicKey, err := cbor.Marshal(map[int]interface{}{1: 2, 3: -7, -1: 1, -2: x, -3: y})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attested := make([]byte, 16) // AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialId)))
+	attested = append(attested, a.credentialId...)
+	attested = append(attested, publicKey...)
+
+	attestation, err := cbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authenticatorData(flagUserPresent|flagUserVerified|flagAttested, attested),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"id":    b64.EncodeToString(a.credentialId),
+		"rawId": b64.EncodeToString(a.credentialId),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64.EncodeToString(a.clientData(t, "webauthn.create", creation.Response.Challenge)),
+			"attestationObject": b64.EncodeToString(attestation),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+// 用当前的 signCount 对挑战签名
+func (a *softAuthenticator) assert(t *testing.T, assertion *protocol.CredentialAssertion, userHandle string) []byte {
+	authData := a.authenticatorData(flagUserPresent|flagUserVerified, nil)
+	clientData := a.clientData(t, "webauthn.get", assertion.Response.Challenge)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"id":    b64.EncodeToString(a.credentialId),
+		"rawId": b64.EncodeToString(a.credentialId),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64.EncodeToString(clientData),
+			"authenticatorData": b64.EncodeToString(authData),
+			"signature":         b64.EncodeToString(signature),
+			"userHandle":        b64.EncodeToString([]byte(userHandle)),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func newTestInstance(t *testing.T) *webauthn.WebAuthn {
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          testRPID,
+		RPDisplayName: "Blog",
+		RPOrigins:     []string{testOrigin},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wa
+}
+
+// 完整流程：注册 -> 登录 -> 计数增长后再次登录 -> 计数回退被拒绝
+func TestPasskeyCeremonies(t *testing.T) {
+	wa := newTestInstance(t)
+	authenticator := newSoftAuthenticator(t)
+	user := &passkeyUser{uid: "100000001", username: "alice"}
+
+	creation, session, err := beginRegistration(wa, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creation.Response.AuthenticatorSelection.ResidentKey != protocol.ResidentKeyRequirementRequired {
+		t.Fatalf("resident key = %q, want required", creation.Response.AuthenticatorSelection.ResidentKey)
+	}
+
+	credential, err := createCredential(wa, user, session, bytes.NewReader(authenticator.register(t, creation)))
+	if err != nil {
+		t.Fatalf("createCredential: %v", err)
+	}
+	if !bytes.Equal(credential.ID, authenticator.credentialId) {
+		t.Fatalf("credential id mismatch")
+	}
+	user.credentials = []webauthn.Credential{*credential}
+
+	// 与 loadUser 一样，计数以保存的值为准
+	load := func(uid string) (*passkeyUser, error) {
+		if uid != user.uid {
+			return nil, errors.New("unknown user")
+		}
+		return user, nil
+	}
+	login := func() (*webauthn.Credential, error) {
+		assertion, session, err := beginLogin(wa)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, credential, err := validateLogin(wa, session, bytes.NewReader(authenticator.assert(t, assertion, user.uid)), load)
+		return credential, err
+	}
+
+	authenticator.signCount = 1
+	credential, err = login()
+	if err != nil {
+		t.Fatalf("first login: %v", err)
+	}
+	if credential.Authenticator.SignCount != 1 {
+		t.Fatalf("sign count = %d, want 1", credential.Authenticator.SignCount)
+	}
+	user.credentials[0].Authenticator.SignCount = credential.Authenticator.SignCount
+
+	authenticator.signCount = 5
+	credential, err = login()
+	if err != nil {
+		t.Fatalf("second login: %v", err)
+	}
+	if credential.Authenticator.SignCount != 5 {
+		t.Fatalf("sign count = %d, want 5", credential.Authenticator.SignCount)
+	}
+	user.credentials[0].Authenticator.SignCount = credential.Authenticator.SignCount
+
+	authenticator.signCount = 3
+	if _, err := login(); !errors.Is(err, ErrClonedPasskey) {
+		t.Fatalf("regressed counter: err = %v, want ErrClonedPasskey", err)
+	}
+}
+
+func TestRegistrationRejectsWrongChallenge(t *testing.T) {
+	wa := newTestInstance(t)
+	authenticator := newSoftAuthenticator(t)
+	user := &passkeyUser{uid: "100000002", username: "bob"}
+
+	creation, _, err := beginRegistration(wa, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 使用另一次仪式的 session
+	_, otherSession, err := beginRegistration(wa, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := createCredential(wa, user, otherSession, bytes.NewReader(authenticator.register(t, creation))); err == nil {
+		t.Fatal("createCredential accepted a response for a different challenge")
+	}
+}